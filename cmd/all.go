@@ -3,17 +3,40 @@ package cmd
 import (
 	"como/utils"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/spf13/cobra"
 )
 
 var (
-	allOutputDir  string
-	allIgnore     []string
-	allProjectDir string
-	allSkipBinary bool
+	allOutputDir      string
+	allIgnore         []string
+	allInclude        []string
+	allProjectDir     string
+	allAllowSensitive bool
+	allSkipBinary     bool
+	allFormat         string
+	allTemplate       string
+	allCountTokens    bool
+	allEncoding       string
+	allMaxTokens      int
+	allPriority       []string
+	allSplitSize      string
+	allSplitTokens    int
+	allRef            string
+	allHeader         string
+	allSecrets        string
+	allSecretPatterns []string
+	allJobs           int
+	allTransforms     []string
+	allStripComments  bool
+	allCollapseBlank  bool
+	allKeepLicense    bool
+	allLineNumbers    bool
+	allMaxFileSize    string
 )
 
 // allCmd represents the all command
@@ -25,7 +48,7 @@ var allCmd = &cobra.Command{
 			the content of all relevant files and project structure into a single output.
 			This is useful for creating a comprehensive context snapshot of your project.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		fmt.Fprintln(cmd.OutOrStdout(), "Building project context...")
+		utils.Log.Infof("Building project context...")
 
 		currentDir, err := os.Getwd()
 		if err != nil {
@@ -42,29 +65,165 @@ var allCmd = &cobra.Command{
 			}
 		}
 
-		fmt.Fprintf(cmd.OutOrStdout(), "  Project Directory: %s\n", allProjectDir)
+		format, err := utils.ParseFormat(allFormat)
+		if err != nil {
+			return err
+		}
+
+		secrets, err := utils.NewSecretScanner(allSecrets, allSecretPatterns)
+		if err != nil {
+			return err
+		}
+		defer secrets.LogSummary()
+
+		transformNames := append([]string(nil), allTransforms...)
+		if allStripComments {
+			transformNames = append(transformNames, utils.TransformStripComments)
+		}
+		if allCollapseBlank {
+			transformNames = append(transformNames, utils.TransformCollapseBlankLines)
+		}
+		transform, err := utils.NewTransformer(transformNames, utils.TransformOptions{KeepLicense: allKeepLicense})
+		if err != nil {
+			return err
+		}
+		if allLineNumbers && transform != nil {
+			return fmt.Errorf("--line-numbers cannot be combined with transforms (%s): the numbers would count the transformed lines, not the lines on disk", strings.Join(transform.Names(), ", "))
+		}
+
+		var maxFileSize int64
+		if allMaxFileSize != "" {
+			size, err := utils.ParseByteSize(allMaxFileSize)
+			if err != nil {
+				return err
+			}
+			maxFileSize = int64(size)
+		}
+
+		utils.Log.Verbosef("  Project Directory: %s", allProjectDir)
 		if allOutputDir != "" {
-			fmt.Fprintf(cmd.OutOrStdout(), "  Output File: %s\n", allOutputDir)
+			utils.Log.Verbosef("  Output File: %s", allOutputDir)
 		} else {
-			fmt.Fprintln(cmd.OutOrStdout(), "  Output: stdout")
+			utils.Log.Verbosef("  Output: stdout")
+		}
+		utils.Log.Verbosef("  Ignore Patterns: %v", allIgnore)
+		if len(allInclude) > 0 {
+			utils.Log.Verbosef("  Include Patterns: %v", allInclude)
+		}
+		if allRef != "" {
+			utils.Log.Verbosef("  Git Ref: %s", allRef)
+		}
+		utils.Log.Verbosef("  Skip Binary Files: %v", allSkipBinary)
+		if maxFileSize > 0 {
+			utils.Log.Verbosef("  Max File Size: %d bytes", maxFileSize)
+		}
+		if names := transform.Names(); len(names) > 0 {
+			utils.Log.Verbosef("  Transforms: %v", names)
+		}
+		if allLineNumbers {
+			utils.Log.Verbosef("  Line Numbers: on")
+		}
+		if allTemplate != "" {
+			utils.Log.Verbosef("  Template: %s", allTemplate)
+		} else {
+			utils.Log.Verbosef("  Format: %s", format)
 		}
-		fmt.Fprintf(cmd.OutOrStdout(), "  Ignore Patterns: %v\n", allIgnore)
-		fmt.Fprintf(cmd.OutOrStdout(), "  Skip Binary Files: %v\n", allSkipBinary)
 
-		// 1. List files
-		// For 'all' command, specificFileArgs is nil as we scan the directory.
-		// We don't include directories in the result for concatenation.
-		filesToProcess, err := utils.GetProjectFiles(allProjectDir, allIgnore, true, nil, false)
-		if err != nil {
-			return fmt.Errorf("failed to list project files: %w", err)
+		// 1. List files and 2. generate tree, both from the same listing
+		var listed []utils.FileInfo
+		if allRef != "" {
+			// Read the project as of a Git ref instead of the working tree
+			var reader *utils.GitObjectReader
+			listed, reader, err = utils.GetProjectFilesAtRef(allProjectDir, allRef, allIgnore, allInclude, nil, true, allAllowSensitive)
+			if err != nil {
+				return fmt.Errorf("failed to list project files at %s: %w", allRef, err)
+			}
+			defer reader.Close()
+		} else {
+			// Directories are listed for the tree only.
+			listed, err = utils.GetProjectFiles(allProjectDir, allIgnore, allInclude, true, nil, true, allAllowSensitive)
+			if err != nil {
+				return fmt.Errorf("failed to list project files: %w", err)
+			}
 		}
+		filesToProcess := utils.WithoutDirs(listed)
+		treeString := utils.BuildFileTreeFromFiles(filepath.Base(allProjectDir), listed).String()
 
 		if len(filesToProcess) == 0 {
-			fmt.Fprintln(cmd.OutOrStdout(), "No files found to process after applying ignores.")
+			utils.Log.Infof("No files found to process after applying ignores.")
+			return nil
+		}
+
+		newRenderer := func(w io.Writer) (utils.Renderer, error) {
+			if allTemplate != "" {
+				return utils.NewTemplateRenderer(allTemplate, w)
+			}
+			return utils.NewRenderer(format, w)
+		}
+		doc := utils.DocumentInfo{ProjectName: filepath.Base(allProjectDir), ProjectDir: allProjectDir, Ref: allRef, Header: allHeader}
+
+		// Pack the files into the token budget, if one was given
+		var omitted []utils.FileInfo
+		if allMaxTokens > 0 {
+			tokenizer, err := utils.NewTokenizer(allEncoding)
+			if err != nil {
+				return err
+			}
+			packOpts := utils.PackOptions{MaxTokens: allMaxTokens, NewRenderer: newRenderer, Doc: doc, Tree: treeString, Priority: allPriority, SkipBinary: allSkipBinary, Jobs: allJobs, MaxFileSize: maxFileSize, Secrets: secrets, Transform: transform, LineNumbers: allLineNumbers}
+			packed, err := utils.PackFiles(filesToProcess, allProjectDir, tokenizer, packOpts)
+			if err != nil {
+				return err
+			}
+			filesToProcess, omitted = packed.Selected, packed.Omitted
+			utils.Log.Infof("Token budget: using ~%d of %d tokens, omitting %d file(s)", packed.UsedTokens, allMaxTokens, len(omitted))
+			for _, fi := range omitted {
+				utils.Log.Verbosef("  Omitted (token budget): %s", fi.RelPath)
+			}
+			if packed.UsedTokens > allMaxTokens {
+				utils.Log.Warnf("the bundle exceeds the token budget even without the omitted files, which are still listed in it")
+			}
+		}
+
+		// Refuse to write anything if a file holds a secret
+		if secrets.Mode == utils.SecretsFail {
+			checkOpts := utils.RenderOptions{SkipBinary: allSkipBinary, Jobs: allJobs, MaxFileSize: maxFileSize, Secrets: secrets, Transform: transform, LineNumbers: allLineNumbers}
+			if err := utils.CheckSecrets(filesToProcess, checkOpts); err != nil {
+				return err
+			}
+		}
+
+		// 3a. Split into numbered parts if requested
+		if allSplitSize != "" || allSplitTokens > 0 {
+			splitOpts := utils.SplitOptions{MaxTokens: allSplitTokens, Tree: treeString, SkipBinary: allSkipBinary, Omitted: omitted, Jobs: allJobs, MaxFileSize: maxFileSize, Secrets: secrets, Transform: transform, LineNumbers: allLineNumbers}
+			if allSplitSize != "" {
+				if splitOpts.MaxBytes, err = utils.ParseByteSize(allSplitSize); err != nil {
+					return err
+				}
+			} else if splitOpts.Tokenizer, err = utils.NewTokenizer(allEncoding); err != nil {
+				return err
+			}
+
+			outputPath := allOutputDir
+			if outputPath == "" || outputPath == "-" {
+				outputPath = "context" + utils.FormatExtension(format)
+				if allTemplate != "" {
+					outputPath = "context.txt"
+				}
+			}
+
+			utils.Log.Infof("Splitting context into parts...")
+			paths, err := utils.RenderSplitProject(newRenderer, doc, filesToProcess, outputPath, splitOpts)
+			if err != nil {
+				return err
+			}
+			for _, path := range paths {
+				utils.Log.Infof("  Wrote %s", path)
+			}
+			utils.Log.Infof("Project context built successfully in %d part(s).", len(paths))
 			return nil
 		}
 
-		// 2. Get output writer
+		// 3b. Get output writer
 		writer, outFile, err := utils.GetOutputWriter(allOutputDir)
 		if err != nil {
 			return err
@@ -78,60 +237,36 @@ var allCmd = &cobra.Command{
 			defer writer.Flush()
 		}
 
-		// 3. Generate and write tree
-		treeString, err := utils.BuildFileTree(allProjectDir, allIgnore, true, nil, true)
+		renderer, err := newRenderer(writer)
 		if err != nil {
-			return fmt.Errorf("failed to generate file tree: %w", err)
-		}
-
-		if _, err := writer.WriteString("--- START FILE: PROJECT STRUCTURE ---\n"); err != nil {
-			return fmt.Errorf("failed to write tree start marker: %w", err)
-		}
-		if _, err := writer.WriteString(treeString); err != nil {
-			return fmt.Errorf("failed to write tree content: %w", err)
-		}
-		if _, err := writer.WriteString("\n--- END FILE: PROJECT STRUCTURE ---\n\n"); err != nil {
-			return fmt.Errorf("failed to write tree end marker: %w", err)
+			return err
 		}
 
-		// 4. Read content of each remaining file and concatenate
-		fmt.Fprintln(cmd.OutOrStdout(), "Concatenating files...")
-		for _, fileInfo := range filesToProcess {
-			// Skip directories and symlinks for concatenation
-			if fileInfo.IsDir || fileInfo.IsSymlink {
-				// GetProjectFiles with includeDirsInResult=false should already filter these, but double check.
-				// If it's a symlink to a file, it might be processed if not filtered earlier.
-				// For now, GetProjectFiles with false should only return regular files.
-				continue
-			}
-
-			content, isBinary, err := utils.ReadFileContent(fileInfo.AbsPath)
+		var counter *utils.TokenCountingRenderer
+		if allCountTokens {
+			tokenizer, err := utils.NewTokenizer(allEncoding)
 			if err != nil {
-				fmt.Fprintf(cmd.ErrOrStderr(), "Warning: skipping file %s due to read error: %v\n", fileInfo.RelPath, err)
-				continue
-			}
-
-			if isBinary && allSkipBinary {
-				fmt.Fprintf(cmd.OutOrStdout(), "  Skipping binary file: %s\n", fileInfo.RelPath)
-				continue
+				return err
 			}
+			counter = utils.NewTokenCountingRenderer(renderer, tokenizer)
+			renderer = counter
+		}
 
-			// Write separator and content
-			separatorStart := fmt.Sprintf("--- START FILE: %s ---\n", fileInfo.RelPath)
-			separatorEnd := fmt.Sprintf("\n--- END FILE: %s ---\n\n", fileInfo.RelPath)
+		// 4. Render tree and the content of each remaining file
+		utils.Log.Infof("Concatenating files...")
+		opts := utils.RenderOptions{Tree: treeString, SkipBinary: allSkipBinary, Omitted: omitted, Jobs: allJobs, MaxFileSize: maxFileSize, Secrets: secrets, Transform: transform, LineNumbers: allLineNumbers}
+		if err := utils.RenderProject(renderer, doc, filesToProcess, opts); err != nil {
+			return err
+		}
 
-			if _, err := writer.WriteString(separatorStart); err != nil {
-				return fmt.Errorf("failed to write start separator for %s: %w", fileInfo.RelPath, err)
-			}
-			if _, err := writer.WriteString(content); err != nil {
-				return fmt.Errorf("failed to write content for %s: %w", fileInfo.RelPath, err)
-			}
-			if _, err := writer.WriteString(separatorEnd); err != nil {
-				return fmt.Errorf("failed to write end separator for %s: %w", fileInfo.RelPath, err)
+		if counter != nil {
+			// The report was explicitly requested, so it is shown even with --quiet.
+			if err := counter.Report.Write(cmd.ErrOrStderr()); err != nil {
+				return err
 			}
 		}
 
-		fmt.Fprintln(cmd.OutOrStdout(), "Project context built successfully.")
+		utils.Log.Infof("Project context built successfully.")
 		return nil
 	},
 }
@@ -142,5 +277,30 @@ func init() {
 	allCmd.Flags().StringVarP(&allProjectDir, "dir", "d", ".", "Path to the project directory")
 	allCmd.Flags().StringVarP(&allOutputDir, "output", "o", "", "Output file path for the concatenated content (default: stdout, use '-' for stdout)")
 	allCmd.Flags().StringSliceVarP(&allIgnore, "ignore", "i", []string{}, "Comma-separated glob patterns of files/directories to ignore (e.g., 'tests/*,*.log')")
+	allCmd.Flags().BoolVar(&allAllowSensitive, "allow-sensitive", false, "Include files that usually hold credentials (.env, private keys, keystores, ...), which are withheld by default")
+	allCmd.Flags().StringSliceVar(&allInclude, "include", []string{}, "Comma-separated glob patterns of files to include, applied after ignores; '**' matches any directories (e.g. 'services/**/*.go,services/**/*.sql')")
 	allCmd.Flags().BoolVar(&allSkipBinary, "skip-binary", true, "Skip binary files from concatenation")
+	allCmd.Flags().StringVarP(&allFormat, "format", "f", utils.FormatText, "Output format: text, markdown, xml, json or jsonl")
+	allCmd.Flags().StringVar(&allTemplate, "template", "", "Render output with a Go text/template file instead of a built-in format")
+	allCmd.MarkFlagsMutuallyExclusive("format", "template")
+	allCmd.Flags().BoolVar(&allCountTokens, "count-tokens", false, "Report per-file and total token counts on stderr")
+	allCmd.Flags().StringVar(&allEncoding, "encoding", utils.EncodingCL100K, "Token encoding for counting: cl100k_base, o200k_base or approx")
+	allCmd.Flags().IntVar(&allMaxTokens, "max-tokens", 0, "Only include the files that fit into this many tokens (0 for no limit)")
+	allCmd.Flags().StringSliceVar(&allPriority, "priority", []string{}, "Glob patterns of files to keep first when packing into --max-tokens; '**' matches any directories")
+	allCmd.Flags().StringVar(&allSplitSize, "split-size", "", "Split output into numbered parts of at most this size (e.g. 100k); parts are named after --output, e.g. context.part1.txt")
+	allCmd.Flags().IntVar(&allSplitTokens, "split-tokens", 0, "Split output into numbered parts of at most this many tokens")
+	allCmd.Flags().StringVar(&allRef, "ref", "", "Read the project as of this Git commit, tag or branch instead of the working tree")
+	allCmd.Flags().IntVarP(&allJobs, "jobs", "j", 0, "Number of files to read in parallel (0 for one per CPU)")
+	allCmd.Flags().StringSliceVar(&allTransforms, "transform", []string{}, "Rewrite file content before output: go-skeleton (Go declarations and doc comments without function bodies), strip-comments, collapse-blank-lines or none")
+	allCmd.Flags().BoolVar(&allStripComments, "strip-comments", false, "Remove comments from source files in languages the stripper knows (same as --transform strip-comments)")
+	allCmd.Flags().BoolVar(&allKeepLicense, "keep-license", false, "With --strip-comments, keep a leading comment that states a license or copyright")
+	allCmd.Flags().BoolVar(&allCollapseBlank, "collapse-blank-lines", false, "Replace runs of blank lines with a single empty line (same as --transform collapse-blank-lines)")
+	allCmd.Flags().StringVar(&allMaxFileSize, "max-file-size", "", "Cut each file off after this size (e.g. 1m); truncated files are marked in the output")
+	allCmd.Flags().BoolVar(&allLineNumbers, "line-numbers", false, "Prefix every line of file content with its number, so answers can point at lines")
+	allCmd.Flags().StringVar(&allHeader, "header", "", "Text to put at the top of the output, e.g. instructions for the model")
+	allCmd.Flags().StringVar(&allSecrets, "secrets", utils.SecretsRedact, "How to handle keys, tokens and passwords found in files: redact, skip, fail or off")
+	allCmd.Flags().StringArrayVar(&allSecretPatterns, "secret-pattern", []string{}, "Regular expression matching an additional kind of secret (repeatable); with a capture group, only the group is treated as the secret")
+	allCmd.MarkFlagsMutuallyExclusive("split-size", "split-tokens")
+	allCmd.MarkFlagsMutuallyExclusive("split-size", "count-tokens")
+	allCmd.MarkFlagsMutuallyExclusive("split-tokens", "count-tokens")
 }
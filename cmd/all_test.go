@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"como/utils"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLineNumbersRejectTransforms(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	dir := t.TempDir()
+	for _, args := range [][]string{
+		{"all", "--dir", dir, "--line-numbers", "--strip-comments"},
+		{"all", "--dir", dir, "--line-numbers", "--transform", "go-skeleton"},
+		{"files", "--dir", dir, "--line-numbers", "--collapse-blank-lines", "main.go"},
+	} {
+		t.Run(strings.Join(args, " "), func(t *testing.T) {
+			rootCmd.SetArgs(args)
+			rootCmd.SetOut(io.Discard)
+			rootCmd.SetErr(io.Discard)
+			t.Cleanup(func() {
+				allLineNumbers, allStripComments, allTransforms = false, false, nil
+				filesLineNumbers, filesCollapseBlank = false, false
+			})
+			err := rootCmd.Execute()
+			if err == nil || !strings.Contains(err.Error(), "--line-numbers cannot be combined") {
+				t.Errorf("error %v, want --line-numbers rejected", err)
+			}
+		})
+	}
+}
+
+func TestTransformFlagsLeaveSliceFlagAlone(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "main.go"), []byte("package main\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	out := filepath.Join(t.TempDir(), "out.txt")
+	for _, tt := range []struct {
+		flag *[]string
+		args []string
+	}{
+		{&allTransforms, []string{"all", "--dir", dir, "-o", out, "--strip-comments", "--collapse-blank-lines"}},
+		{&filesTransforms, []string{"files", "--dir", dir, "-o", out, "--strip-comments", "--collapse-blank-lines", "main.go"}},
+	} {
+		t.Run(tt.args[0], func(t *testing.T) {
+			// A slice with room to grow, as a config value can leave it
+			backing := make([]string, 3)
+			backing[0] = utils.TransformNone
+			*tt.flag = backing[:1]
+			rootCmd.SetArgs(tt.args)
+			rootCmd.SetOut(io.Discard)
+			rootCmd.SetErr(io.Discard)
+			t.Cleanup(func() {
+				*tt.flag = nil
+				allStripComments, allCollapseBlank, filesStripComments, filesCollapseBlank = false, false, false, false
+			})
+			if err := rootCmd.Execute(); err != nil {
+				t.Fatal(err)
+			}
+			if backing[1] != "" || backing[2] != "" {
+				t.Errorf("flag's backing array changed to %q", backing)
+			}
+		})
+	}
+}
@@ -0,0 +1,157 @@
+package cmd
+
+import (
+	"como/utils"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	diffOutputDir       string
+	diffIgnore          []string
+	diffProjectDir      string
+	diffAllowSensitive  bool
+	diffSkipBinary      bool
+	diffFormat          string
+	diffTemplate        string
+	diffSince           string
+	diffStaged          bool
+	diffRange           string
+	diffIncludeOriginal bool
+	diffCountTokens     bool
+	diffEncoding        string
+	diffHeader          string
+	diffSecrets         string
+	diffSecretPatterns  []string
+)
+
+// diffCmd represents the diff command
+var diffCmd = &cobra.Command{
+	Use:   "diff",
+	Short: "Bundle the changes since a Git ref for review",
+	Long: `The 'diff' command bundles the unified diff of a set of changes followed
+			by the full current content of every touched file, ready for a review
+			prompt. Without flags it uses uncommitted changes (HEAD to working tree);
+			--since compares the working tree with the point it forked from a
+			branch, --staged uses staged changes and --range a commit range.
+			--include-original adds the pre-change version of each file as well.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		currentDir, err := os.Getwd()
+		if err != nil {
+			return fmt.Errorf("failed to get current working directory: %w", err)
+		}
+
+		if diffProjectDir == "" || diffProjectDir == "." {
+			diffProjectDir = currentDir
+		} else {
+			diffProjectDir, err = filepath.Abs(diffProjectDir)
+			if err != nil {
+				return fmt.Errorf("failed to resolve project directory path %s: %w", diffProjectDir, err)
+			}
+		}
+
+		format, err := utils.ParseFormat(diffFormat)
+		if err != nil {
+			return err
+		}
+
+		secrets, err := utils.NewSecretScanner(diffSecrets, diffSecretPatterns)
+		if err != nil {
+			return err
+		}
+		defer secrets.LogSummary()
+
+		// 1. Work out what to compare and list the touched files
+		spec, err := utils.ResolveDiffSpec(diffProjectDir, diffSince, diffStaged, diffRange)
+		if err != nil {
+			return err
+		}
+		utils.Log.Verbosef("  Project Directory: %s", diffProjectDir)
+		utils.Log.Verbosef("  Comparing: %s (%s -> %s)", spec.Description, spec.OldRev, spec.NewRev)
+		utils.Log.Verbosef("  Ignore Patterns: %v", diffIgnore)
+
+		changed, err := utils.ChangedFiles(diffProjectDir, spec, diffIgnore, diffAllowSensitive)
+		if err != nil {
+			return err
+		}
+		if len(changed) == 0 {
+			utils.Log.Infof("No changes found (%s).", spec.Description)
+			return nil
+		}
+		utils.Log.Infof("Bundling %d changed file(s) (%s)...", len(changed), spec.Description)
+		for _, f := range changed {
+			utils.Log.Verbosef("  %s %s", f.Status, f.RelPath)
+		}
+
+		// 2. Render the diff and the files
+		writer, outFile, err := utils.GetOutputWriter(diffOutputDir)
+		if err != nil {
+			return err
+		}
+		if outFile != nil {
+			defer outFile.Close()
+		}
+		defer writer.Flush()
+
+		var renderer utils.Renderer
+		if diffTemplate != "" {
+			renderer, err = utils.NewTemplateRenderer(diffTemplate, writer)
+		} else {
+			renderer, err = utils.NewRenderer(format, writer)
+		}
+		if err != nil {
+			return err
+		}
+
+		var counter *utils.TokenCountingRenderer
+		if diffCountTokens {
+			tokenizer, err := utils.NewTokenizer(diffEncoding)
+			if err != nil {
+				return err
+			}
+			counter = utils.NewTokenCountingRenderer(renderer, tokenizer)
+			renderer = counter
+		}
+
+		doc := utils.DocumentInfo{ProjectName: filepath.Base(diffProjectDir), ProjectDir: diffProjectDir, Header: diffHeader}
+		opts := utils.DiffRenderOptions{SkipBinary: diffSkipBinary, IncludeOriginal: diffIncludeOriginal, Secrets: secrets}
+		if err := utils.RenderDiff(renderer, doc, diffProjectDir, spec, changed, opts); err != nil {
+			return err
+		}
+
+		if counter != nil {
+			// The report was explicitly requested, so it is shown even with --quiet.
+			if err := counter.Report.Write(cmd.ErrOrStderr()); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(diffCmd)
+
+	diffCmd.Flags().StringVarP(&diffProjectDir, "dir", "d", ".", "Path to the project directory (only changes below it are included)")
+	diffCmd.Flags().StringVarP(&diffOutputDir, "output", "o", "", "Output file path for the bundle (default: stdout, use '-' for stdout)")
+	diffCmd.Flags().StringSliceVarP(&diffIgnore, "ignore", "i", []string{}, "Comma-separated glob patterns of changed files to leave out")
+	diffCmd.Flags().BoolVar(&diffAllowSensitive, "allow-sensitive", false, "Include files that usually hold credentials (.env, private keys, keystores, ...), which are withheld by default")
+	diffCmd.Flags().BoolVar(&diffSkipBinary, "skip-binary", true, "Skip binary files")
+	diffCmd.Flags().StringVarP(&diffFormat, "format", "f", utils.FormatText, "Output format: text, markdown, xml, json or jsonl")
+	diffCmd.Flags().StringVar(&diffTemplate, "template", "", "Render output with a Go text/template file instead of a built-in format")
+	diffCmd.MarkFlagsMutuallyExclusive("format", "template")
+	diffCmd.Flags().StringVar(&diffSince, "since", "", "Include changes on the working tree since it forked from this ref (e.g. main)")
+	diffCmd.Flags().BoolVar(&diffStaged, "staged", false, "Include staged changes only")
+	diffCmd.Flags().StringVar(&diffRange, "range", "", "Include the changes of a commit range, a..b or a...b")
+	diffCmd.MarkFlagsMutuallyExclusive("since", "staged", "range")
+	diffCmd.Flags().BoolVar(&diffIncludeOriginal, "include-original", false, "Also include the pre-change version of modified and deleted files")
+	diffCmd.Flags().BoolVar(&diffCountTokens, "count-tokens", false, "Report per-file and total token counts on stderr")
+	diffCmd.Flags().StringVar(&diffEncoding, "encoding", utils.EncodingCL100K, "Token encoding for counting: cl100k_base, o200k_base or approx")
+	diffCmd.Flags().StringVar(&diffHeader, "header", "", "Text to put at the top of the output, e.g. review instructions for the model")
+	diffCmd.Flags().StringVar(&diffSecrets, "secrets", utils.SecretsRedact, "How to handle keys, tokens and passwords found in files: redact, skip, fail or off")
+	diffCmd.Flags().StringArrayVar(&diffSecretPatterns, "secret-pattern", []string{}, "Regular expression matching an additional kind of secret (repeatable); with a capture group, only the group is treated as the secret")
+}
@@ -3,17 +3,38 @@ package cmd
 import (
 	"como/utils"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/spf13/cobra"
 )
 
 var (
-	filesOutputDir  string
-	filesIgnore     []string
-	filesProjectDir string
-	filesSkipBinary bool
+	filesOutputDir      string
+	filesIgnore         []string
+	filesProjectDir     string
+	filesAllowSensitive bool
+	filesSkipBinary     bool
+	filesFormat         string
+	filesTemplate       string
+	filesCountTokens    bool
+	filesEncoding       string
+	filesMaxTokens      int
+	filesPriority       []string
+	filesRef            string
+	filesHeader         string
+	filesSecrets        string
+	filesSecretPatterns []string
+	filesJobs           int
+	filesTransforms     []string
+	filesStripComments  bool
+	filesCollapseBlank  bool
+	filesKeepLicense    bool
+	filesLineNumbers    bool
+	filesKeepExplicit   bool
+	filesMaxFileSize    string
 )
 
 // filesCmd represents the files command
@@ -23,10 +44,12 @@ var filesCmd = &cobra.Command{
 	Long: `The 'files' command concatenates the content of specified project files or files matching glob patterns.
 		You can specify which files to include via arguments and further exclude using ignore patterns.
 		The --dir flag acts as the base directory for resolving relative file paths and glob patterns.
+		Patterns may use '**' to match any number of directories, a directory argument selects
+		everything below it and '!pattern' excludes files again; .gitignore is respected.
 		This command is useful for gathering specific code or text parts for an LLM.`,
 	Args: cobra.MinimumNArgs(1), // Require at least one file/glob argument
 	RunE: func(cmd *cobra.Command, args []string) error {
-		fmt.Fprintln(cmd.OutOrStdout(), "Executing 'files' command...")
+		utils.Log.Infof("Executing 'files' command...")
 
 		currentDir, err := os.Getwd()
 		if err != nil {
@@ -43,32 +66,132 @@ var filesCmd = &cobra.Command{
 			}
 		}
 
-		fmt.Fprintf(cmd.OutOrStdout(), "  Project Directory (base for files): %s\n", filesProjectDir)
-		fmt.Fprintf(cmd.OutOrStdout(), "  Files/Globs to process: %v\n", args)
+		format, err := utils.ParseFormat(filesFormat)
+		if err != nil {
+			return err
+		}
+
+		secrets, err := utils.NewSecretScanner(filesSecrets, filesSecretPatterns)
+		if err != nil {
+			return err
+		}
+		defer secrets.LogSummary()
+
+		transformNames := append([]string(nil), filesTransforms...)
+		if filesStripComments {
+			transformNames = append(transformNames, utils.TransformStripComments)
+		}
+		if filesCollapseBlank {
+			transformNames = append(transformNames, utils.TransformCollapseBlankLines)
+		}
+		transform, err := utils.NewTransformer(transformNames, utils.TransformOptions{KeepExplicit: filesKeepExplicit, KeepLicense: filesKeepLicense})
+		if err != nil {
+			return err
+		}
+		if filesLineNumbers && transform != nil {
+			return fmt.Errorf("--line-numbers cannot be combined with transforms (%s): the numbers would count the transformed lines, not the lines on disk", strings.Join(transform.Names(), ", "))
+		}
+
+		var maxFileSize int64
+		if filesMaxFileSize != "" {
+			size, err := utils.ParseByteSize(filesMaxFileSize)
+			if err != nil {
+				return err
+			}
+			maxFileSize = int64(size)
+		}
+
+		utils.Log.Verbosef("  Project Directory (base for files): %s", filesProjectDir)
+		utils.Log.Verbosef("  Files/Globs to process: %v", args)
 		if filesOutputDir != "" {
-			fmt.Fprintf(cmd.OutOrStdout(), "  Output File: %s\n", filesOutputDir)
+			utils.Log.Verbosef("  Output File: %s", filesOutputDir)
+		} else {
+			utils.Log.Verbosef("  Output: stdout")
+		}
+		utils.Log.Verbosef("  Ignore Patterns: %v", filesIgnore)
+		if filesRef != "" {
+			utils.Log.Verbosef("  Git Ref: %s", filesRef)
+		}
+		utils.Log.Verbosef("  Skip Binary Files: %v", filesSkipBinary)
+		if maxFileSize > 0 {
+			utils.Log.Verbosef("  Max File Size: %d bytes", maxFileSize)
+		}
+		if names := transform.Names(); len(names) > 0 {
+			utils.Log.Verbosef("  Transforms: %v", names)
+		}
+		if filesLineNumbers {
+			utils.Log.Verbosef("  Line Numbers: on")
+		}
+		if filesTemplate != "" {
+			utils.Log.Verbosef("  Template: %s", filesTemplate)
 		} else {
-			fmt.Fprintln(cmd.OutOrStdout(), "  Output: stdout")
+			utils.Log.Verbosef("  Format: %s", format)
 		}
-		fmt.Fprintf(cmd.OutOrStdout(), "  Ignore Patterns: %v\n", filesIgnore)
-		fmt.Fprintf(cmd.OutOrStdout(), "  Skip Binary Files: %v\n", filesSkipBinary)
 
 		// 1. List files based on arguments and apply ignores
 		// For 'files' command, specificFileArgs is args from CLI.
 		// We don't include directories in the result for concatenation.
-		filesToProcess, err := utils.GetProjectFiles(filesProjectDir, filesIgnore, true, args, false)
-		if err != nil {
-			return fmt.Errorf("failed to list specified project files: %w", err)
+		var filesToProcess []utils.FileInfo
+		if filesRef != "" {
+			var reader *utils.GitObjectReader
+			filesToProcess, reader, err = utils.GetProjectFilesAtRef(filesProjectDir, filesRef, filesIgnore, nil, args, false, filesAllowSensitive)
+			if err != nil {
+				return fmt.Errorf("failed to list specified project files at %s: %w", filesRef, err)
+			}
+			defer reader.Close()
+		} else {
+			filesToProcess, err = utils.GetProjectFiles(filesProjectDir, filesIgnore, nil, true, args, false, filesAllowSensitive)
+			if err != nil {
+				return fmt.Errorf("failed to list specified project files: %w", err)
+			}
 		}
 
 		if len(filesToProcess) == 0 {
-			fmt.Fprintln(cmd.OutOrStdout(), "No files found matching the arguments after applying ignores.")
+			utils.Log.Infof("No files found matching the arguments after applying ignores.")
 			return nil
 		}
 
-		fmt.Fprintln(cmd.OutOrStdout(), "Files to be concatenated:")
+		utils.Log.Verbosef("Files to be concatenated:")
 		for _, fi := range filesToProcess {
-			fmt.Fprintf(cmd.OutOrStdout(), "  - %s\n", fi.RelPath)
+			utils.Log.Verbosef("  - %s", fi.RelPath)
+		}
+
+		newRenderer := func(w io.Writer) (utils.Renderer, error) {
+			if filesTemplate != "" {
+				return utils.NewTemplateRenderer(filesTemplate, w)
+			}
+			return utils.NewRenderer(format, w)
+		}
+		doc := utils.DocumentInfo{ProjectName: filepath.Base(filesProjectDir), ProjectDir: filesProjectDir, Ref: filesRef, Header: filesHeader}
+
+		// Pack the files into the token budget, if one was given
+		var omitted []utils.FileInfo
+		if filesMaxTokens > 0 {
+			tokenizer, err := utils.NewTokenizer(filesEncoding)
+			if err != nil {
+				return err
+			}
+			packOpts := utils.PackOptions{MaxTokens: filesMaxTokens, NewRenderer: newRenderer, Doc: doc, Priority: filesPriority, SkipBinary: filesSkipBinary, Jobs: filesJobs, MaxFileSize: maxFileSize, Secrets: secrets, Transform: transform, LineNumbers: filesLineNumbers}
+			packed, err := utils.PackFiles(filesToProcess, filesProjectDir, tokenizer, packOpts)
+			if err != nil {
+				return err
+			}
+			filesToProcess, omitted = packed.Selected, packed.Omitted
+			utils.Log.Infof("Token budget: using ~%d of %d tokens, omitting %d file(s)", packed.UsedTokens, filesMaxTokens, len(omitted))
+			for _, fi := range omitted {
+				utils.Log.Verbosef("  Omitted (token budget): %s", fi.RelPath)
+			}
+			if packed.UsedTokens > filesMaxTokens {
+				utils.Log.Warnf("the bundle exceeds the token budget even without the omitted files, which are still listed in it")
+			}
+		}
+
+		// Refuse to write anything if a file holds a secret
+		if secrets.Mode == utils.SecretsFail {
+			checkOpts := utils.RenderOptions{SkipBinary: filesSkipBinary, Jobs: filesJobs, MaxFileSize: maxFileSize, Secrets: secrets, Transform: transform, LineNumbers: filesLineNumbers}
+			if err := utils.CheckSecrets(filesToProcess, checkOpts); err != nil {
+				return err
+			}
 		}
 
 		// 2. Get output writer
@@ -83,40 +206,36 @@ var filesCmd = &cobra.Command{
 			defer writer.Flush()
 		}
 
-		// 3. Read content of each remaining file and concatenate
-		fmt.Fprintln(cmd.OutOrStdout(), "Concatenating files...")
-		for _, fileInfo := range filesToProcess {
-			// Should be filtered by GetProjectFiles with includeDirsInResult=false
-			if fileInfo.IsDir || fileInfo.IsSymlink {
-				continue
-			}
+		renderer, err := newRenderer(writer)
+		if err != nil {
+			return err
+		}
 
-			content, isBinary, err := utils.ReadFileContent(fileInfo.AbsPath)
+		var counter *utils.TokenCountingRenderer
+		if filesCountTokens {
+			tokenizer, err := utils.NewTokenizer(filesEncoding)
 			if err != nil {
-				fmt.Fprintf(cmd.ErrOrStderr(), "Warning: skipping file %s due to read error: %v\n", fileInfo.RelPath, err)
-				continue
-			}
-
-			if isBinary && filesSkipBinary {
-				fmt.Fprintf(cmd.OutOrStdout(), "  Skipping binary file: %s\n", fileInfo.RelPath)
-				continue
+				return err
 			}
+			counter = utils.NewTokenCountingRenderer(renderer, tokenizer)
+			renderer = counter
+		}
 
-			separatorStart := fmt.Sprintf("--- START FILE: %s ---\n", fileInfo.RelPath)
-			separatorEnd := fmt.Sprintf("\n--- END FILE: %s ---\n\n", fileInfo.RelPath)
+		// 3. Render the content of each remaining file
+		utils.Log.Infof("Concatenating files...")
+		opts := utils.RenderOptions{SkipBinary: filesSkipBinary, Omitted: omitted, Jobs: filesJobs, MaxFileSize: maxFileSize, Secrets: secrets, Transform: transform, LineNumbers: filesLineNumbers}
+		if err := utils.RenderProject(renderer, doc, filesToProcess, opts); err != nil {
+			return err
+		}
 
-			if _, err := writer.WriteString(separatorStart); err != nil {
-				return fmt.Errorf("failed to write start separator for %s: %w", fileInfo.RelPath, err)
-			}
-			if _, err := writer.WriteString(content); err != nil {
-				return fmt.Errorf("failed to write content for %s: %w", fileInfo.RelPath, err)
-			}
-			if _, err := writer.WriteString(separatorEnd); err != nil {
-				return fmt.Errorf("failed to write end separator for %s: %w", fileInfo.RelPath, err)
+		if counter != nil {
+			// The report was explicitly requested, so it is shown even with --quiet.
+			if err := counter.Report.Write(cmd.ErrOrStderr()); err != nil {
+				return err
 			}
 		}
 
-		fmt.Fprintln(cmd.OutOrStdout(), "'files' command executed successfully.")
+		utils.Log.Infof("'files' command executed successfully.")
 		return nil
 	},
 }
@@ -127,5 +246,25 @@ func init() {
 	filesCmd.Flags().StringVarP(&filesProjectDir, "dir", "d", ".", "Base path for resolving file arguments and .gitignore")
 	filesCmd.Flags().StringVarP(&filesOutputDir, "output", "o", "", "Output file path for the concatenated files (default: stdout, use '-' for stdout)")
 	filesCmd.Flags().StringSliceVarP(&filesIgnore, "ignore", "i", []string{}, "Comma-separated glob patterns of files/directories to ignore from the specified list")
+	filesCmd.Flags().BoolVar(&filesAllowSensitive, "allow-sensitive", false, "Include files that usually hold credentials (.env, private keys, keystores, ...), which are withheld by default")
 	filesCmd.Flags().BoolVar(&filesSkipBinary, "skip-binary", true, "Skip binary files from concatenation")
+	filesCmd.Flags().StringVarP(&filesFormat, "format", "f", utils.FormatText, "Output format: text, markdown, xml, json or jsonl")
+	filesCmd.Flags().StringVar(&filesTemplate, "template", "", "Render output with a Go text/template file instead of a built-in format")
+	filesCmd.MarkFlagsMutuallyExclusive("format", "template")
+	filesCmd.Flags().BoolVar(&filesCountTokens, "count-tokens", false, "Report per-file and total token counts on stderr")
+	filesCmd.Flags().StringVar(&filesEncoding, "encoding", utils.EncodingCL100K, "Token encoding for counting: cl100k_base, o200k_base or approx")
+	filesCmd.Flags().IntVar(&filesMaxTokens, "max-tokens", 0, "Only include the files that fit into this many tokens (0 for no limit)")
+	filesCmd.Flags().StringSliceVar(&filesPriority, "priority", []string{}, "Glob patterns of files to keep first when packing into --max-tokens; '**' matches any directories")
+	filesCmd.Flags().StringVar(&filesRef, "ref", "", "Read files as of this Git commit, tag or branch instead of the working tree")
+	filesCmd.Flags().IntVarP(&filesJobs, "jobs", "j", 0, "Number of files to read in parallel (0 for one per CPU)")
+	filesCmd.Flags().StringSliceVar(&filesTransforms, "transform", []string{}, "Rewrite file content before output: go-skeleton (Go declarations and doc comments without function bodies), strip-comments, collapse-blank-lines or none")
+	filesCmd.Flags().BoolVar(&filesStripComments, "strip-comments", false, "Remove comments from source files in languages the stripper knows (same as --transform strip-comments)")
+	filesCmd.Flags().BoolVar(&filesKeepLicense, "keep-license", false, "With --strip-comments, keep a leading comment that states a license or copyright")
+	filesCmd.Flags().BoolVar(&filesCollapseBlank, "collapse-blank-lines", false, "Replace runs of blank lines with a single empty line (same as --transform collapse-blank-lines)")
+	filesCmd.Flags().BoolVar(&filesKeepExplicit, "keep-explicit", false, "Leave files named literally on the command line untransformed by --transform")
+	filesCmd.Flags().StringVar(&filesMaxFileSize, "max-file-size", "", "Cut each file off after this size (e.g. 1m); truncated files are marked in the output")
+	filesCmd.Flags().BoolVar(&filesLineNumbers, "line-numbers", false, "Prefix every line of file content with its number, so answers can point at lines")
+	filesCmd.Flags().StringVar(&filesHeader, "header", "", "Text to put at the top of the output, e.g. instructions for the model")
+	filesCmd.Flags().StringVar(&filesSecrets, "secrets", utils.SecretsRedact, "How to handle keys, tokens and passwords found in files: redact, skip, fail or off")
+	filesCmd.Flags().StringArrayVar(&filesSecretPatterns, "secret-pattern", []string{}, "Regular expression matching an additional kind of secret (repeatable); with a capture group, only the group is treated as the secret")
 }
@@ -1,10 +1,23 @@
 package cmd
 
 import (
+	"como/utils"
 	"fmt"
+	"maps"
 	"os"
+	"slices"
+	"strconv"
+	"strings"
 
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+var (
+	quiet      bool
+	verbosity  int
+	configFile string
+	profile    string
 )
 
 // rootCmd represents the base command when called without any subcommands
@@ -17,6 +30,15 @@ var rootCmd = &cobra.Command{
 			You can concatenate files, generate file trees and more, with
 			options to ignore specific files or directories and specify output locations.`,
 	Version: "0.0.1",
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		setLogger(cmd)
+		if err := initConfig(cmd); err != nil {
+			return err
+		}
+		// The config may have set --quiet or --verbose
+		setLogger(cmd)
+		return nil
+	},
 	Run: func(cmd *cobra.Command, args []string) {
 
 	},
@@ -36,7 +58,11 @@ func Execute() {
 // var projectDir string // Example: if --dir was global
 
 func init() {
-	// cobra.OnInitialize(initConfig)
+	rootCmd.PersistentFlags().BoolVarP(&quiet, "quiet", "q", false, "Suppress progress messages and warnings")
+	rootCmd.PersistentFlags().CountVarP(&verbosity, "verbose", "v", "Increase diagnostic output on stderr (-v verbose, -vv debug)")
+	rootCmd.MarkFlagsMutuallyExclusive("quiet", "verbose")
+	rootCmd.PersistentFlags().StringVar(&configFile, "config", "", "Config file to use instead of the nearest "+utils.ConfigFileName+" (the user config still applies)")
+	rootCmd.PersistentFlags().StringVarP(&profile, "profile", "p", "", "Apply a named profile from the config file")
 
 	// Example of a persistent flag available to all subcommands:
 	// rootCmd.PersistentFlags().StringVar(&projectDir, "dir", ".", "Path to the project directory")
@@ -48,7 +74,182 @@ func init() {
 	//       rootCmd.AddCommand(updateCmd)
 }
 
-// initConfig reads in config file and ENV variables if set.
-// func initConfig() {
-// 	// ...
-// }
+// setLogger installs the logger for the --quiet and --verbose flags.
+// Diagnostics always go to stderr; stdout is reserved for the payload.
+func setLogger(cmd *cobra.Command) {
+	level := utils.LogNormal
+	switch {
+	case quiet:
+		level = utils.LogQuiet
+	case verbosity == 1:
+		level = utils.LogVerbose
+	case verbosity > 1:
+		level = utils.LogDebug
+	}
+	utils.SetLogger(utils.NewLogger(cmd.ErrOrStderr(), level))
+}
+
+// commandConfigOnly is the annotation of flags that the config sets only
+// from the command's own section, because the flag means something else
+// than the flag of the same name on other commands.
+const commandConfigOnly = "como_command_config_only"
+
+// initConfig reads the user config file and the nearest .como.yaml above the
+// command's --dir (or --config), and uses them as defaults for every flag
+// not given on the command line.
+func initConfig(cmd *cobra.Command) error {
+	projectFile := configFile
+	if projectFile == "" {
+		dir := "."
+		if flag := cmd.Flags().Lookup("dir"); flag != nil {
+			dir = flag.Value.String()
+		}
+		projectFile = utils.FindConfigFile(dir)
+	} else if _, err := os.Stat(projectFile); err != nil {
+		return fmt.Errorf("failed to read config file %s: %w", projectFile, err)
+	}
+
+	config, err := utils.LoadConfig(utils.UserConfigFile(), projectFile)
+	if err != nil {
+		return err
+	}
+	for _, source := range config.Sources {
+		utils.Log.Verbosef("  Config File: %s", source)
+	}
+
+	var commandOnly []string
+	cmd.Flags().VisitAll(func(flag *pflag.Flag) {
+		if _, ok := flag.Annotations[commandConfigOnly]; ok {
+			commandOnly = append(commandOnly, flag.Name)
+		}
+	})
+	values, err := config.FlagValuesFor(cmd.Name(), profile, commandOnly)
+	if err != nil {
+		return err
+	}
+	if configFile == "" && projectFile != "" {
+		if err := guardProjectConfig(cmd, projectFile, values, commandOnly); err != nil {
+			return err
+		}
+	}
+	for name, value := range values {
+		if err := applyConfigValue(cmd, name, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// guardProjectConfig drops values from a project config found next to the
+// files that relax a protection or choose where files are read from and
+// written to: a repository must not switch the secret scanning off, let
+// sensitive files in, overwrite files through --output or redirect and
+// force the writes of unpack for whoever runs como on it. Such values are
+// honoured from the user config, --config or the command line.
+func guardProjectConfig(cmd *cobra.Command, projectFile string, values utils.FlagValues, commandOnly []string) error {
+	userConfig, err := utils.LoadConfig(utils.UserConfigFile())
+	if err != nil {
+		return err
+	}
+	userProfile := profile
+	if _, ok := userConfig.Profiles[profile]; !ok {
+		userProfile = ""
+	}
+	userValues, err := userConfig.FlagValuesFor(cmd.Name(), userProfile, commandOnly)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(guardedConfigKeys)) {
+		value, ok := values[name]
+		flag := cmd.Flags().Lookup(name)
+		if !ok || flag == nil || flag.Changed || !guardedConfigKeys[name](value) {
+			continue
+		}
+		userValue, fromUser := userValues[name]
+		if fromUser && slices.Equal(utils.ConfigValueStrings(value), utils.ConfigValueStrings(userValue)) {
+			continue
+		}
+		utils.Log.Warnf("ignoring %s: %s from %s; set it in %s or on the command line instead",
+			name, strings.Join(utils.ConfigValueStrings(value), ","), projectFile, utils.UserConfigFile())
+		if fromUser {
+			values[name] = userValue
+		} else {
+			delete(values, name)
+		}
+	}
+	return nil
+}
+
+// guardedConfigKeys maps the options a project config may not set to a
+// check of whether a value is one it may not set.
+var guardedConfigKeys = map[string]func(value any) bool{
+	"secrets": func(value any) bool {
+		v, ok := singleConfigValue(value)
+		return ok && strings.EqualFold(v, utils.SecretsOff)
+	},
+	"allow-sensitive": configValueTrue,
+	"force":           configValueTrue,
+	"git-stash":       configValueTrue,
+	"output":          configValueSet,
+	"dir":             configValueSet,
+	"backup-dir":      configValueSet,
+}
+
+// singleConfigValue returns a configured value that is not a list, trimmed.
+func singleConfigValue(value any) (string, bool) {
+	values := utils.ConfigValueStrings(value)
+	if len(values) != 1 {
+		return "", false
+	}
+	return strings.TrimSpace(values[0]), true
+}
+
+// configValueTrue reports whether a configured value turns a boolean flag
+// on.
+func configValueTrue(value any) bool {
+	v, ok := singleConfigValue(value)
+	if !ok {
+		return false
+	}
+	on, err := strconv.ParseBool(v)
+	return err == nil && on
+}
+
+// configValueSet reports whether a configured value is anything but empty.
+func configValueSet(value any) bool {
+	return strings.Join(utils.ConfigValueStrings(value), "") != ""
+}
+
+// applyConfigValue sets a flag from the config unless it was given on the
+// command line. The flag is not marked as changed, so a configured default
+// never conflicts with a mutually exclusive flag given explicitly.
+func applyConfigValue(cmd *cobra.Command, name string, value any) error {
+	if name == "config" || name == "profile" {
+		return fmt.Errorf("config option %q can only be given on the command line", name)
+	}
+	flag := cmd.Flags().Lookup(name)
+	if flag == nil {
+		utils.Log.Debugf("config option %q does not apply to '%s'", name, cmd.Name())
+		return nil
+	}
+	if flag.Changed {
+		return nil
+	}
+
+	values := utils.ConfigValueStrings(value)
+	utils.Log.Debugf("config sets --%s=%s", name, strings.Join(values, ","))
+	if slice, ok := flag.Value.(pflag.SliceValue); ok {
+		if err := slice.Replace(values); err != nil {
+			return fmt.Errorf("invalid config value for %s: %w", name, err)
+		}
+		return nil
+	}
+	if len(values) != 1 {
+		return fmt.Errorf("invalid config value for %s: expected a single value, got %v", name, value)
+	}
+	if err := flag.Value.Set(values[0]); err != nil {
+		return fmt.Errorf("invalid config value %q for %s: %w", values[0], name, err)
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+package cmd
+
+import (
+	"como/utils"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+// newConfigTestCommand returns a command with the flags the project config
+// guard looks at, plus one it leaves alone.
+func newConfigTestCommand() *cobra.Command {
+	cmd := &cobra.Command{Use: "unpack"}
+	cmd.Flags().String("dir", ".", "")
+	cmd.Flags().String("output", "", "")
+	cmd.Flags().String("backup-dir", "", "")
+	cmd.Flags().String("secrets", utils.SecretsRedact, "")
+	cmd.Flags().Bool("allow-sensitive", false, "")
+	cmd.Flags().Bool("force", false, "")
+	cmd.Flags().Bool("git-stash", false, "")
+	cmd.Flags().String("format", "auto", "")
+	return cmd
+}
+
+// runConfigTest writes the project and user configs, runs initConfig from
+// the project directory and returns the command and the warnings logged.
+func runConfigTest(t *testing.T, projectConfig, userConfig string) (*cobra.Command, string) {
+	t.Helper()
+	project, xdg := t.TempDir(), t.TempDir()
+	if err := os.WriteFile(filepath.Join(project, utils.ConfigFileName), []byte(projectConfig), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if userConfig != "" {
+		if err := os.MkdirAll(filepath.Join(xdg, "como"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(xdg, "como", "config.yaml"), []byte(userConfig), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("XDG_CONFIG_HOME", xdg)
+	t.Chdir(project)
+
+	var log strings.Builder
+	utils.SetLogger(utils.NewLogger(&log, utils.LogNormal))
+	t.Cleanup(func() { utils.SetLogger(utils.NewLogger(os.Stderr, utils.LogNormal)) })
+
+	cmd := newConfigTestCommand()
+	if err := initConfig(cmd); err != nil {
+		t.Fatal(err)
+	}
+	return cmd, log.String()
+}
+
+var guardedConfigTests = []struct {
+	name  string
+	value string
+	want  string // The flag's value when the project config is ignored
+}{
+	{"secrets", "off", utils.SecretsRedact},
+	{"allow-sensitive", "true", "false"},
+	{"force", "true", "false"},
+	{"git-stash", "true", "false"},
+	{"output", "/tmp/overwritten.txt", ""},
+	{"dir", "/elsewhere", "."},
+	{"backup-dir", "/elsewhere/backup", ""},
+}
+
+func TestProjectConfigCannotRelaxProtections(t *testing.T) {
+	for _, tt := range guardedConfigTests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd, log := runConfigTest(t, "defaults:\n  "+tt.name+": "+tt.value+"\n", "")
+			if got := cmd.Flags().Lookup(tt.name).Value.String(); got != tt.want {
+				t.Errorf("--%s = %q, want %q", tt.name, got, tt.want)
+			}
+			if !strings.Contains(log, "ignoring "+tt.name) {
+				t.Errorf("no warning about %s, log: %q", tt.name, log)
+			}
+		})
+	}
+}
+
+func TestProjectConfigGuardInCommandSectionsAndProfiles(t *testing.T) {
+	cmd, log := runConfigTest(t, "defaults:\n  unpack:\n    force: true\n", "")
+	if got := cmd.Flags().Lookup("force").Value.String(); got != "false" {
+		t.Errorf("--force = %q from the unpack section, want false", got)
+	}
+	if !strings.Contains(log, "ignoring force") {
+		t.Errorf("no warning about force in the command section, log: %q", log)
+	}
+
+	profile = "x"
+	t.Cleanup(func() { profile = "" })
+	cmd, log = runConfigTest(t, "profiles:\n  x:\n    unpack:\n      git-stash: true\n", "")
+	if got := cmd.Flags().Lookup("git-stash").Value.String(); got != "false" {
+		t.Errorf("--git-stash = %q from a project profile, want false", got)
+	}
+	if !strings.Contains(log, "ignoring git-stash") {
+		t.Errorf("no warning about git-stash, log: %q", log)
+	}
+}
+
+func TestUserConfigCanRelaxProtections(t *testing.T) {
+	for _, tt := range guardedConfigTests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := "defaults:\n  " + tt.name + ": " + tt.value + "\n"
+			cmd, log := runConfigTest(t, config, config)
+			if got := cmd.Flags().Lookup(tt.name).Value.String(); got != tt.value {
+				t.Errorf("--%s = %q, want %q from the user config", tt.name, got, tt.value)
+			}
+			if log != "" {
+				t.Errorf("unexpected warning: %q", log)
+			}
+		})
+	}
+}
+
+func TestProjectConfigFallsBackToUserValue(t *testing.T) {
+	cmd, _ := runConfigTest(t, "defaults:\n  output: /tmp/project.txt\n", "defaults:\n  output: mine.txt\n")
+	if got := cmd.Flags().Lookup("output").Value.String(); got != "mine.txt" {
+		t.Errorf("--output = %q, want the user config's mine.txt", got)
+	}
+}
+
+func TestProjectConfigKeepsSafeValues(t *testing.T) {
+	cmd, log := runConfigTest(t, "defaults:\n  secrets: skip\n  force: false\n  git-stash: false\n  format: markdown\n", "")
+	for name, want := range map[string]string{"secrets": "skip", "force": "false", "git-stash": "false", "format": "markdown"} {
+		if got := cmd.Flags().Lookup(name).Value.String(); got != want {
+			t.Errorf("--%s = %q, want %q", name, got, want)
+		}
+	}
+	if log != "" {
+		t.Errorf("unexpected warning: %q", log)
+	}
+}
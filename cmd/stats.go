@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"como/utils"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	statsIgnore         []string
+	statsProjectDir     string
+	statsAllowSensitive bool
+	statsSkipBinary     bool
+	statsEncoding       string
+	statsSort           string
+)
+
+// statsCmd represents the stats command
+var statsCmd = &cobra.Command{
+	Use:   "stats",
+	Short: "Report token counts for the project context",
+	Long: `The 'stats' command lists the same files as 'all' and reports how many
+			tokens each of them, the project structure and the whole bundle take.
+			Counting uses BPE ranks bundled in the binary, so it works offline.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		currentDir, err := os.Getwd()
+		if err != nil {
+			return fmt.Errorf("failed to get current working directory: %w", err)
+		}
+
+		if statsProjectDir == "" || statsProjectDir == "." {
+			statsProjectDir = currentDir
+		} else {
+			statsProjectDir, err = filepath.Abs(statsProjectDir)
+			if err != nil {
+				return fmt.Errorf("failed to resolve project directory path %s: %w", statsProjectDir, err)
+			}
+		}
+
+		if statsSort != "tokens" && statsSort != "path" {
+			return fmt.Errorf("invalid --sort value %q (supported: tokens, path)", statsSort)
+		}
+
+		utils.Log.Verbosef("  Project Directory: %s", statsProjectDir)
+		utils.Log.Verbosef("  Ignore Patterns: %v", statsIgnore)
+		utils.Log.Verbosef("  Encoding: %s", statsEncoding)
+
+		tokenizer, err := utils.NewTokenizer(statsEncoding)
+		if err != nil {
+			return err
+		}
+
+		// 1. List files
+		listed, err := utils.GetProjectFiles(statsProjectDir, statsIgnore, nil, true, nil, true, statsAllowSensitive)
+		if err != nil {
+			return fmt.Errorf("failed to list project files: %w", err)
+		}
+		filesToProcess := utils.WithoutDirs(listed)
+		treeString := utils.BuildFileTreeFromFiles(filepath.Base(statsProjectDir), listed).String()
+
+		// 2. Count tokens by running the render pipeline without output
+		counter := utils.NewTokenCountingRenderer(&discardRenderer{}, tokenizer)
+		doc := utils.DocumentInfo{ProjectName: filepath.Base(statsProjectDir), ProjectDir: statsProjectDir}
+		opts := utils.RenderOptions{Tree: treeString, SkipBinary: statsSkipBinary}
+		if err := utils.RenderProject(counter, doc, filesToProcess, opts); err != nil {
+			return err
+		}
+
+		// 3. Write report
+		if statsSort == "tokens" {
+			counter.Report.SortByTokens()
+		}
+		return counter.Report.Write(cmd.OutOrStdout())
+	},
+}
+
+// discardRenderer accepts everything and writes nothing.
+type discardRenderer struct{}
+
+func (*discardRenderer) BeginDocument(doc utils.DocumentInfo) error        { return nil }
+func (*discardRenderer) WriteTree(tree string) error                       { return nil }
+func (*discardRenderer) WriteFile(file utils.RenderFile) error             { return nil }
+func (*discardRenderer) SkipFile(file utils.FileInfo, reason string) error { return nil }
+func (*discardRenderer) EndDocument() error                                { return nil }
+
+func init() {
+	rootCmd.AddCommand(statsCmd)
+
+	statsCmd.Flags().StringVarP(&statsProjectDir, "dir", "d", ".", "Path to the project directory")
+	statsCmd.Flags().StringSliceVarP(&statsIgnore, "ignore", "i", []string{}, "Comma-separated glob patterns of files/directories to ignore")
+	statsCmd.Flags().BoolVar(&statsAllowSensitive, "allow-sensitive", false, "Include files that usually hold credentials (.env, private keys, keystores, ...), which are withheld by default")
+	statsCmd.Flags().BoolVar(&statsSkipBinary, "skip-binary", true, "Skip binary files from the counts")
+	statsCmd.Flags().StringVar(&statsEncoding, "encoding", utils.EncodingCL100K, "Token encoding: cl100k_base, o200k_base or approx")
+	statsCmd.Flags().StringVar(&statsSort, "sort", "tokens", "Sort files by 'tokens' (descending) or 'path'")
+}
@@ -10,9 +10,12 @@ import (
 )
 
 var (
-	treeOutputDir  string
-	treeIgnore     []string
-	treeProjectDir string
+	treeOutputDir      string
+	treeIgnore         []string
+	treeInclude        []string
+	treeProjectDir     string
+	treeAllowSensitive bool
+	treeRef            string
 )
 
 // treeCmd represents the tree command
@@ -23,7 +26,7 @@ var treeCmd = &cobra.Command{
 			respecting .gitignore and custom ignore patterns.
 			It outputs a structured tree representation.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		fmt.Fprintln(cmd.OutOrStdout(), "Executing 'tree' command...")
+		utils.Log.Infof("Executing 'tree' command...")
 
 		currentDir, err := os.Getwd()
 		if err != nil {
@@ -39,20 +42,35 @@ var treeCmd = &cobra.Command{
 			}
 		}
 
-		fmt.Fprintf(cmd.OutOrStdout(), "  Project Directory: %s\n", treeProjectDir)
+		utils.Log.Verbosef("  Project Directory: %s", treeProjectDir)
 		if treeOutputDir != "" {
-			fmt.Fprintf(cmd.OutOrStdout(), "  Output File: %s\n", treeOutputDir)
+			utils.Log.Verbosef("  Output File: %s", treeOutputDir)
 		} else {
-			fmt.Fprintln(cmd.OutOrStdout(), "  Output: stdout")
+			utils.Log.Verbosef("  Output: stdout")
+		}
+		utils.Log.Verbosef("  Ignore Patterns: %v", treeIgnore)
+		if len(treeInclude) > 0 {
+			utils.Log.Verbosef("  Include Patterns: %v", treeInclude)
+		}
+		if treeRef != "" {
+			utils.Log.Verbosef("  Git Ref: %s", treeRef)
 		}
-		fmt.Fprintf(cmd.OutOrStdout(), "  Ignore Patterns: %v\n", treeIgnore)
 
 		// 1. Generate file tree string
 		// TODO: Design consideration - include ignored files or not?
-		treeString, err := utils.BuildFileTree(treeProjectDir, treeIgnore, true, nil, true)
-
-		if err != nil {
-			return fmt.Errorf("failed to generate file tree: %w", err)
+		var tree *utils.FileTree
+		if treeRef != "" {
+			listed, reader, err := utils.GetProjectFilesAtRef(treeProjectDir, treeRef, treeIgnore, treeInclude, nil, true, treeAllowSensitive)
+			if err != nil {
+				return fmt.Errorf("failed to generate file tree at %s: %w", treeRef, err)
+			}
+			reader.Close()
+			tree = utils.BuildFileTreeFromFiles(filepath.Base(treeProjectDir), listed)
+		} else {
+			tree, err = utils.BuildFileTree(treeProjectDir, treeIgnore, treeInclude, true, nil, true, treeAllowSensitive)
+			if err != nil {
+				return fmt.Errorf("failed to generate file tree: %w", err)
+			}
 		}
 
 		// 2. Get output writer
@@ -68,11 +86,11 @@ var treeCmd = &cobra.Command{
 		}
 
 		// 3. Write tree string to output
-		if _, err := writer.WriteString(treeString); err != nil {
+		if _, err := writer.WriteString(tree.String()); err != nil {
 			return fmt.Errorf("failed to write tree to output: %w", err)
 		}
 
-		fmt.Fprintln(cmd.OutOrStdout(), "File tree generated successfully.")
+		utils.Log.Infof("File tree generated successfully.")
 		return nil
 	},
 }
@@ -83,4 +101,7 @@ func init() {
 	treeCmd.Flags().StringVarP(&treeProjectDir, "dir", "d", ".", "Path to the project directory")
 	treeCmd.Flags().StringVarP(&treeOutputDir, "output", "o", "", "Output file path for the file tree (default: stdout, use '-' for stdout)")
 	treeCmd.Flags().StringSliceVarP(&treeIgnore, "ignore", "i", []string{}, "Comma-separated glob patterns of files/directories to ignore")
+	treeCmd.Flags().BoolVar(&treeAllowSensitive, "allow-sensitive", false, "Include files that usually hold credentials (.env, private keys, keystores, ...), which are withheld by default")
+	treeCmd.Flags().StringSliceVar(&treeInclude, "include", []string{}, "Comma-separated glob patterns of files to list, '**' matching any directories (e.g. 'services/**/*.go')")
+	treeCmd.Flags().StringVar(&treeRef, "ref", "", "List the project as of this Git commit, tag or branch instead of the working tree")
 }
@@ -0,0 +1,189 @@
+package cmd
+
+import (
+	"como/utils"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	unpackProjectDir     string
+	unpackFormat         string
+	unpackDryRun         bool
+	unpackDiff           bool
+	unpackForce          bool
+	unpackBase           string
+	unpackBackupDir      string
+	unpackGitStash       bool
+	unpackSecretPatterns []string
+	unpackStripNumbers   bool
+)
+
+// unpackCmd represents the unpack command
+var unpackCmd = &cobra.Command{
+	Use:   "unpack [bundle_file]...",
+	Short: "Write files from a bundle back into the project",
+	Long: `The 'unpack' command reads a bundle in any of the output formats (for
+			example one edited by an LLM) and writes its files back under --dir.
+			The format is detected unless --format is given; with no file, or "-",
+			the bundle is read from standard input. Parts of a split bundle can be
+			passed together.
+
+			Paths outside --dir are refused. When the bundle records the hash of
+			the original content (json, jsonl) or --base names the bundle the
+			edits started from, files changed on disk since then are reported as
+			conflicts and left alone unless --force is given. Secrets redacted
+			in the bundle are put back from the files on disk, and line numbers
+			added with --line-numbers are stripped off again.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		currentDir, err := os.Getwd()
+		if err != nil {
+			return fmt.Errorf("failed to get current working directory: %w", err)
+		}
+
+		if unpackProjectDir == "" || unpackProjectDir == "." {
+			unpackProjectDir = currentDir
+		} else {
+			unpackProjectDir, err = filepath.Abs(unpackProjectDir)
+			if err != nil {
+				return fmt.Errorf("failed to resolve project directory path %s: %w", unpackProjectDir, err)
+			}
+		}
+
+		utils.Log.Verbosef("  Project Directory: %s", unpackProjectDir)
+		utils.Log.Verbosef("  Bundles: %v", args)
+
+		// 1. Parse the bundle(s)
+		if len(args) == 0 {
+			args = []string{"-"}
+		}
+		var files []utils.BundleFile
+		for _, arg := range args {
+			parsed, err := readBundle(cmd, arg, unpackFormat)
+			if err != nil {
+				return err
+			}
+			files = append(files, parsed...)
+		}
+		// Slices of a file may be spread across parts
+		files = utils.JoinPartialFiles(files)
+		if len(files) == 0 {
+			return fmt.Errorf("no files found in the bundle")
+		}
+
+		// Secrets redacted when the bundle was made are restored from disk
+		secrets, err := utils.NewSecretScanner(utils.SecretsRedact, unpackSecretPatterns)
+		if err != nil {
+			return err
+		}
+		opts := utils.UnpackOptions{Force: unpackForce, Secrets: secrets, StripLineNumbers: unpackStripNumbers}
+		if unpackBase != "" {
+			baseFiles, err := readBundle(cmd, unpackBase, "auto")
+			if err != nil {
+				return fmt.Errorf("failed to read base bundle: %w", err)
+			}
+			opts.BaseHashes = utils.BundleHashes(baseFiles)
+		}
+
+		// 2. Plan and report
+		changes, err := utils.PlanUnpack(unpackProjectDir, files, opts)
+		if err != nil {
+			return err
+		}
+
+		counts := make(map[string]int)
+		for _, change := range changes {
+			counts[change.Action]++
+			switch change.Action {
+			case utils.UnpackSkip, utils.UnpackConflict:
+				utils.Log.Warnf("%s %s: %s", change.Action, change.File.Path, change.Reason)
+			case utils.UnpackUnchanged:
+				utils.Log.Verbosef("  %-9s %s", change.Action, change.File.Path)
+			default:
+				utils.Log.Infof("  %-9s %s", change.Action, change.File.Path)
+			}
+			if unpackDiff && (change.Action == utils.UnpackCreate || change.Action == utils.UnpackUpdate || change.Action == utils.UnpackConflict) {
+				oldName := "a/" + change.File.Path
+				if !change.Exists {
+					oldName = "/dev/null"
+				}
+				diff := utils.UnifiedDiff(oldName, "b/"+change.File.Path, change.Old, change.File.Content)
+				if _, err := io.WriteString(cmd.OutOrStdout(), diff); err != nil {
+					return fmt.Errorf("failed to write diff: %w", err)
+				}
+			}
+		}
+
+		if counts[utils.UnpackConflict] > 0 {
+			return fmt.Errorf("%d file(s) changed on disk since the bundle was made; nothing was written (use --force to overwrite)", counts[utils.UnpackConflict])
+		}
+		if unpackDryRun {
+			utils.Log.Infof("Dry run: %d to create, %d to update, %d unchanged, %d skipped.",
+				counts[utils.UnpackCreate], counts[utils.UnpackUpdate], counts[utils.UnpackUnchanged], counts[utils.UnpackSkip])
+			return nil
+		}
+
+		// 3. Back up, then write
+		if counts[utils.UnpackUpdate] > 0 && unpackGitStash {
+			commit, err := utils.GitStashSnapshot(unpackProjectDir, "como unpack backup")
+			if err != nil {
+				return err
+			}
+			if commit != "" {
+				utils.Log.Infof("Saved uncommitted changes as stash %s.", commit[:min(len(commit), 12)])
+			}
+		}
+		backupDir := unpackBackupDir
+		if backupDir != "" && !filepath.IsAbs(backupDir) {
+			backupDir = filepath.Join(unpackProjectDir, backupDir)
+		}
+		if err := utils.ApplyUnpack(unpackProjectDir, changes, backupDir); err != nil {
+			return err
+		}
+
+		utils.Log.Infof("Unpacked into %s: %d created, %d updated, %d unchanged, %d skipped.", unpackProjectDir,
+			counts[utils.UnpackCreate], counts[utils.UnpackUpdate], counts[utils.UnpackUnchanged], counts[utils.UnpackSkip])
+		return nil
+	},
+}
+
+// readBundle parses the bundle at path, or standard input for "-".
+func readBundle(cmd *cobra.Command, path, format string) ([]utils.BundleFile, error) {
+	var data []byte
+	var err error
+	if path == "-" {
+		data, err = io.ReadAll(cmd.InOrStdin())
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read bundle %s: %w", path, err)
+	}
+
+	files, detected, err := utils.ParseBundle(string(data), format)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse bundle %s: %w", path, err)
+	}
+	utils.Log.Verbosef("  Read %d file(s) from %s (%s)", len(files), path, detected)
+	return files, nil
+}
+
+func init() {
+	rootCmd.AddCommand(unpackCmd)
+
+	unpackCmd.Flags().StringVarP(&unpackProjectDir, "dir", "d", ".", "Project directory to write the files into")
+	unpackCmd.Flags().StringVarP(&unpackFormat, "format", "f", "auto", "Bundle format: auto, text, markdown, xml, json or jsonl")
+	unpackCmd.Flags().SetAnnotation("format", commandConfigOnly, []string{"true"})
+	unpackCmd.Flags().BoolVarP(&unpackDryRun, "dry-run", "n", false, "Report what would change without writing anything")
+	unpackCmd.Flags().BoolVar(&unpackDiff, "diff", false, "Print a unified diff of every change to standard output")
+	unpackCmd.Flags().BoolVar(&unpackForce, "force", false, "Overwrite files that changed on disk since the bundle was made")
+	unpackCmd.Flags().StringVar(&unpackBase, "base", "", "Original bundle the edits started from, used to detect conflicts")
+	unpackCmd.Flags().StringVar(&unpackBackupDir, "backup-dir", "", "Copy files to this directory before overwriting them")
+	unpackCmd.Flags().BoolVar(&unpackGitStash, "git-stash", false, "Record uncommitted changes as a git stash entry before writing")
+	unpackCmd.Flags().StringArrayVar(&unpackSecretPatterns, "secret-pattern", []string{}, "Regular expression of an additional kind of secret, as given when the bundle was made, so redacted values can be restored")
+	unpackCmd.Flags().BoolVar(&unpackStripNumbers, "strip-line-numbers", false, "Strip line-number prefixes from every file, also where the bundle does not mark them as numbered")
+}
@@ -0,0 +1,325 @@
+package utils
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/bmatcuk/doublestar/v4"
+	"github.com/gobwas/glob"
+)
+
+// Priority tiers used when packing files into a token budget. Lower tiers are
+// considered first.
+const (
+	tierExplicit   = iota // Named literally on the command line, as a file or --include argument
+	tierPriority          // Matched a --priority pattern
+	tierEntryPoint        // Conventional entry points and manifests
+	tierNormal            // Everything else, most recently changed first
+	tierGenerated         // Lockfiles, minified and generated code
+)
+
+// recentCommitWindow is how many commits are inspected to rank files by
+// how recently they changed.
+const recentCommitWindow = 200
+
+// entryPointNames are file names that usually explain how a project fits
+// together, matched case-insensitively against the base name.
+var entryPointNames = []string{
+	"main.*", "index.*", "app.*", "server.*", "__main__.py", "manage.py",
+	"readme*", "go.mod", "package.json", "cargo.toml", "pyproject.toml",
+	"setup.py", "pom.xml", "build.gradle*", "makefile", "dockerfile",
+}
+
+// generatedPatterns match lockfiles, build output and minified or generated
+// sources, matched against the slash-separated relative path.
+var generatedPatterns = []string{
+	"**package-lock.json", "**yarn.lock", "**pnpm-lock.yaml", "**go.sum",
+	"**Cargo.lock", "**poetry.lock", "**Pipfile.lock", "**composer.lock", "**Gemfile.lock",
+	"**.min.js", "**.min.css", "**.map", "**.pb.go", "**_generated.*", "**.generated.*",
+	"vendor/**", "**/vendor/**", "node_modules/**", "**/node_modules/**", "dist/**", "build/**",
+}
+
+// generatedMarkers are header comments used by code generators.
+var generatedMarkers = []string{"Code generated", "DO NOT EDIT", "@generated", "<auto-generated"}
+
+// PackOptions configures PackFiles. Files are loaded the way the render
+// pipeline loads them, and measured by rendering them with the bundle's
+// renderer.
+type PackOptions struct {
+	MaxTokens   int             // Token budget for the whole bundle
+	NewRenderer RendererFactory // Renderer the bundle is written with; text if nil
+	Doc         DocumentInfo    // Document the bundle is rendered as, --header included
+	Tree        string          // Rendered project structure, counted against the budget
+	Priority    []string        // Doublestar patterns of files to consider right after explicit ones, as for --include
+	SkipBinary  bool            // Binary files will be skipped and cost only a trailer line
+	Jobs        int             // Number of files read in parallel; 0 for one per CPU
+	MaxFileSize int64           // Content beyond this many bytes will be cut off (0 for no limit)
+	Secrets     *SecretScanner  // Scanner the bundle is written with; files it skips cost a trailer line
+	Transform   *Transformer    // Rewrites file content before it is counted, if set
+	LineNumbers bool            // Line numbers will be added to file content
+}
+
+// PackResult is the outcome of PackFiles.
+type PackResult struct {
+	Selected   []FileInfo // Files that fit, in their original order
+	Omitted    []FileInfo // Files left out, in their original order
+	UsedTokens int        // Estimated tokens of the whole bundle
+}
+
+// packCandidate is a file being ranked for the budget.
+type packCandidate struct {
+	index         int
+	tier          int
+	changedAt     int64
+	tokens        int // Cost of the rendered file
+	omittedTokens int // Cost of its line in the skipped-files trailer
+}
+
+// budgetMeter measures parts of a bundle by rendering them.
+type budgetMeter struct {
+	newRenderer RendererFactory
+	doc         DocumentInfo
+	tokenizer   Tokenizer
+
+	empty      int           // Cost of a document without tree or files
+	oneSkipped int           // Cost of a document listing only ref as skipped
+	ref        SkippedRecord // Reference entry of the skipped-files trailer
+}
+
+func (m *budgetMeter) measure(tree string, files []RenderFile, skipped []SkippedRecord) (int, error) {
+	w := &tokenCountingWriter{tokenizer: m.tokenizer}
+	if err := renderDocument(m.newRenderer, m.doc, tree, files, skipped, w); err != nil {
+		return 0, err
+	}
+	return w.Count(), nil
+}
+
+// fileCost returns what rendering file adds to a document.
+func (m *budgetMeter) fileCost(file RenderFile) (int, error) {
+	n, err := m.measure("", []RenderFile{file}, nil)
+	return n - m.empty + splitUnitSlack, err
+}
+
+// skippedCost returns what listing a file as skipped adds to a trailer that
+// is already there. The separator before the line is measured with it, so
+// only a token merged across the boundary is left as slack.
+func (m *budgetMeter) skippedCost(path, reason string) (int, error) {
+	n, err := m.measure("", nil, []SkippedRecord{m.ref, {Path: path, Reason: reason}})
+	return n - m.oneSkipped + 1, err
+}
+
+// PackFiles chooses the subset of files that fits into opts.MaxTokens.
+// Files are ranked by tier (explicit, --priority, entry points, others,
+// generated), by most recent change within a tier and by size; each file is
+// then taken if it still fits, so smaller files can fill the remaining space.
+// Costs include the document header and separators of the selected format
+// and the trailer listing omitted and skipped files.
+func PackFiles(files []FileInfo, rootDir string, tokenizer Tokenizer, opts PackOptions) (PackResult, error) {
+	for _, pattern := range opts.Priority {
+		if !doublestar.ValidatePattern(pattern) {
+			return PackResult{}, fmt.Errorf("invalid priority pattern %s", pattern)
+		}
+	}
+	generatedMatchers := make([]glob.Glob, 0, len(generatedPatterns))
+	for _, pattern := range generatedPatterns {
+		generatedMatchers = append(generatedMatchers, glob.MustCompile(pattern, '/'))
+	}
+
+	// 1. Measure the document itself and the skipped-files trailer
+	m := &budgetMeter{newRenderer: opts.NewRenderer, doc: opts.Doc, tokenizer: tokenizer}
+	if m.newRenderer == nil {
+		m.newRenderer = func(w io.Writer) (Renderer, error) { return NewRenderer(FormatText, w) }
+	}
+	m.ref = SkippedRecord{Path: "file", Reason: SkipReasonBudget}
+	base, err := m.measure(opts.Tree, nil, nil)
+	if err != nil {
+		return PackResult{}, err
+	}
+	if m.empty, err = m.measure("", nil, nil); err != nil {
+		return PackResult{}, err
+	}
+	if m.oneSkipped, err = m.measure("", nil, []SkippedRecord{m.ref}); err != nil {
+		return PackResult{}, err
+	}
+	refLine, err := m.skippedCost(m.ref.Path, m.ref.Reason)
+	if err != nil {
+		return PackResult{}, err
+	}
+	trailerTokens := max(m.oneSkipped-m.empty-refLine+1, 0)
+
+	// 2. Load and measure every file as the render pipeline will
+	changedAt := RecentlyChangedFiles(rootDir, recentCommitWindow)
+	index := make(map[string]int, len(files))
+	for i, fi := range files {
+		index[fi.RelPath] = i
+	}
+	loadOpts := loadOptions{
+		SkipBinary:  opts.SkipBinary,
+		MaxFileSize: opts.MaxFileSize,
+		Jobs:        opts.Jobs,
+		Secrets:     opts.Secrets.withoutResults(),
+		Transform:   opts.Transform,
+		LineNumbers: opts.LineNumbers,
+	}
+	fixedTokens, hasSkipped := base, false
+	var candidates []packCandidate
+	err = loadRenderFiles(files, loadOpts, func(l loadedFile) error {
+		if l.skipReason != "" {
+			// Files the render pipeline skips still cost a trailer line.
+			cost, err := m.skippedCost(l.info.RelPath, l.skipReason)
+			fixedTokens += cost
+			hasSkipped = true
+			return err
+		}
+		c := packCandidate{index: index[l.info.RelPath], tier: tierNormal}
+		var err error
+		if c.tokens, err = m.fileCost(l.file); err != nil {
+			return err
+		}
+		if c.omittedTokens, err = m.skippedCost(l.info.RelPath, SkipReasonBudget); err != nil {
+			return err
+		}
+		head, err := contentHead(l.file)
+		if err != nil {
+			return err
+		}
+
+		slashPath := filepath.ToSlash(l.info.RelPath)
+		c.changedAt = changedAt[slashPath]
+		switch {
+		case l.info.Explicit:
+			c.tier = tierExplicit
+		case matchesIncludePatterns(opts.Priority, slashPath):
+			c.tier = tierPriority
+		case isGenerated(generatedMatchers, slashPath, head):
+			c.tier = tierGenerated
+		case isEntryPoint(slashPath):
+			c.tier = tierEntryPoint
+		}
+		candidates = append(candidates, c)
+		return nil
+	})
+	if err != nil {
+		return PackResult{}, err
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if a.tier != b.tier {
+			return a.tier < b.tier
+		}
+		if a.changedAt != b.changedAt {
+			return a.changedAt > b.changedAt
+		}
+		return a.tokens < b.tokens
+	})
+
+	// 3. Omitted files are still listed in the skipped-files trailer, which
+	// can push a full bundle over the budget; drop the lowest-ranked
+	// selected file and fill again until it fits.
+	evicted := make(map[int]bool)
+	var used int
+	var omitted map[int]bool
+	for {
+		used, omitted = fillBudget(candidates, evicted, fixedTokens, hasSkipped, trailerTokens, opts.MaxTokens)
+		if used <= opts.MaxTokens {
+			break
+		}
+		last := -1
+		for i := len(candidates) - 1; i >= 0; i-- {
+			if !omitted[candidates[i].index] {
+				last = candidates[i].index
+				break
+			}
+		}
+		if last < 0 {
+			break
+		}
+		evicted[last] = true
+	}
+
+	result := PackResult{UsedTokens: used}
+	for i, fi := range files {
+		if omitted[i] {
+			result.Omitted = append(result.Omitted, fi)
+		} else {
+			result.Selected = append(result.Selected, fi)
+		}
+	}
+	return result, nil
+}
+
+// fillBudget greedily takes candidates in rank order while they fit and
+// returns the tokens used and the set of omitted file indexes.
+func fillBudget(candidates []packCandidate, evicted map[int]bool, fixedTokens int, hasSkipped bool, trailerTokens int, maxTokens int) (int, map[int]bool) {
+	used := fixedTokens
+	omitted := make(map[int]bool)
+	for _, c := range candidates {
+		if evicted[c.index] || used+c.tokens > maxTokens {
+			omitted[c.index] = true
+			used += c.omittedTokens
+			continue
+		}
+		used += c.tokens
+	}
+	if len(omitted) > 0 || hasSkipped {
+		used += trailerTokens
+	}
+	return used, omitted
+}
+
+// contentHead returns the start of a loaded file, where code generators put
+// their marker, without reading a streamed file in full.
+func contentHead(file RenderFile) (string, error) {
+	if file.Stream == nil {
+		return file.Content, nil
+	}
+	rc, err := file.Stream.Open()
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+	head := make([]byte, sniffLen)
+	n, err := io.ReadFull(rc, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", fmt.Errorf("failed to read file %s: %w", file.RelPath, err)
+	}
+	return string(head[:n]), nil
+}
+
+func matchesAny(matchers []glob.Glob, path string) bool {
+	for _, m := range matchers {
+		if m.Match(path) {
+			return true
+		}
+	}
+	return false
+}
+
+func isEntryPoint(slashPath string) bool {
+	base := strings.ToLower(filepath.Base(slashPath))
+	for _, pattern := range entryPointNames {
+		if ok, _ := filepath.Match(pattern, base); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func isGenerated(matchers []glob.Glob, slashPath string, content string) bool {
+	if matchesAny(matchers, slashPath) {
+		return true
+	}
+	// Generators put their marker in the file header.
+	lines := strings.SplitN(content, "\n", 6)
+	head := strings.Join(lines[:min(len(lines), 5)], "\n")
+	for _, marker := range generatedMarkers {
+		if strings.Contains(head, marker) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,52 @@
+package utils
+
+import (
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestPackFilesPriorityStaysInDirectory(t *testing.T) {
+	_, infos := writeTestProject(t, map[string]string{
+		"cmd/a.go":     strings.Repeat("a", 4000),
+		"cmd/sub/b.go": strings.Repeat("b", 800),
+		"z.go":         strings.Repeat("z", 800),
+	})
+	// cmd/a.go fits, but nothing else fits next to it. If "*" crossed
+	// directories, the smaller cmd/sub/b.go would be taken first.
+	result, err := PackFiles(infos, t.TempDir(), approxTokenizer{}, PackOptions{MaxTokens: 1100, Priority: []string{"cmd/*.go"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var selected []string
+	for _, fi := range result.Selected {
+		selected = append(selected, filepath.ToSlash(fi.RelPath))
+	}
+	if want := []string{"cmd/a.go"}; !slices.Equal(selected, want) {
+		t.Errorf("selected %v, want %v", selected, want)
+	}
+
+	if _, err := PackFiles(infos, t.TempDir(), approxTokenizer{}, PackOptions{MaxTokens: 1100, Priority: []string{"cmd/[a"}}); err == nil {
+		t.Error("invalid priority pattern accepted")
+	}
+}
+
+func TestIncludeNamedFilesAreExplicit(t *testing.T) {
+	root, _ := writeTestProject(t, map[string]string{
+		"docs/guide.md": "guide\n",
+		"docs/other.md": "other\n",
+		"src/main.go":   "package main\n",
+	})
+	files, err := GetProjectFiles(root, nil, []string{"./docs/guide.md", "src/**"}, false, nil, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, fi := range files {
+		got = append(got, filepath.ToSlash(fi.RelPath)+map[bool]string{true: " explicit", false: ""}[fi.Explicit])
+	}
+	if want := []string{"docs/guide.md explicit", "src/main.go"}; !slices.Equal(got, want) {
+		t.Errorf("listed %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,453 @@
+package utils
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"html"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// BundleFile is a file read back from a bundle by ParseBundle.
+type BundleFile struct {
+	Path     string // Slash-separated path relative to the project root
+	Content  string // File content
+	SHA256   string // Hash recorded in the bundle (json/jsonl only), if any
+	IsBinary bool   // True if the bundle marked the file as binary (no content)
+
+	// Set when the bundle holds only the start of the file (--max-file-size).
+	Truncated    bool
+	OriginalSize int64
+
+	// Names of the transforms (--transform) that rewrote the content.
+	Transforms []string
+
+	// Set when every content line starts with its number (--line-numbers).
+	LineNumbers bool
+
+	// Set when the bundle holds only a range of lines of the file.
+	LineStart  int
+	LineEnd    int
+	TotalLines int
+
+	// Set when the format cannot tell whether the file ended with a
+	// newline (markdown), so Content may end with one the file lacks.
+	FinalNewlineUnknown bool
+}
+
+// treeSectionName is the label of the project structure that renderers
+// emit alongside files.
+const treeSectionName = "PROJECT STRUCTURE"
+
+// lineRangeSuffix matches the " (lines a-b of n)" suffix of partial files.
+var lineRangeSuffix = regexp.MustCompile(`^(.*) \(lines (\d+)-(\d+) of (\d+)\)$`)
+
+// truncatedSuffix matches the " (truncated from n bytes)" suffix of files
+// cut off at the size limit.
+var truncatedSuffix = regexp.MustCompile(`^(.*) \(truncated from (\d+) bytes\)$`)
+
+// transformedSuffix matches the " (transformed: a, b)" suffix of files
+// rewritten by --transform.
+var transformedSuffix = regexp.MustCompile(`^(.*) \(transformed: ([a-z0-9-]+(?:, [a-z0-9-]+)*)\)$`)
+
+// lineNumbersSuffix is the suffix of files made with --line-numbers.
+const lineNumbersSuffix = " (with line numbers)"
+
+// ParseBundle reads the files out of a bundle produced by the text,
+// markdown, xml, json or jsonl renderers. With format "" or "auto" the
+// format is detected. Slices of files split across parts are joined.
+func ParseBundle(data string, format string) ([]BundleFile, string, error) {
+	if format == "" || format == "auto" {
+		format = DetectBundleFormat(data)
+	} else {
+		var err error
+		if format, err = ParseFormat(format); err != nil {
+			return nil, "", err
+		}
+	}
+
+	var files []BundleFile
+	var err error
+	switch format {
+	case FormatJSON:
+		files, err = parseJSONBundle(data)
+	case FormatJSONL:
+		files, err = parseJSONLBundle(data)
+	case FormatXML:
+		files, err = parseXMLBundle(data)
+	case FormatMarkdown:
+		files, err = parseMarkdownBundle(data)
+	default:
+		format = FormatText
+		files, err = parseTextBundle(data)
+	}
+	if err != nil {
+		return nil, format, err
+	}
+
+	// Drop the pseudo-files of diff bundles
+	kept := files[:0]
+	for _, f := range files {
+		if strings.HasPrefix(f.Path, DiffSectionName) || strings.HasSuffix(f.Path, OriginalSuffix) {
+			continue
+		}
+		kept = append(kept, f)
+	}
+	return JoinPartialFiles(kept), format, nil
+}
+
+// DetectBundleFormat guesses which renderer produced data from how it
+// starts, falling back to the markers it contains.
+func DetectBundleFormat(data string) string {
+	trimmed := strings.TrimSpace(data)
+	firstLine, _, _ := strings.Cut(trimmed, "\n")
+	switch {
+	case strings.HasPrefix(firstLine, "{") && json.Valid([]byte(firstLine)):
+		// A complete object on the first line is a record, unless it is a
+		// whole document written without indentation.
+		var keys map[string]json.RawMessage
+		if json.Unmarshal([]byte(firstLine), &keys) == nil && keys["files"] != nil {
+			return FormatJSON
+		}
+		return FormatJSONL
+	case strings.HasPrefix(trimmed, "{"):
+		return FormatJSON
+	case strings.HasPrefix(trimmed, "--- START FILE: "), strings.HasPrefix(trimmed, "--- PART "), strings.HasPrefix(trimmed, "--- HEADER ---"):
+		return FormatText
+	case strings.HasPrefix(trimmed, "<"):
+		return FormatXML
+	case strings.HasPrefix(trimmed, "#"), strings.HasPrefix(trimmed, "```"):
+		return FormatMarkdown
+	case strings.Contains(data, "<document_content>"):
+		return FormatXML
+	case strings.Contains(data, "--- START FILE: "):
+		return FormatText
+	default:
+		return FormatMarkdown
+	}
+}
+
+// splitLabel separates a "path (lines a-b of n)" label into its parts.
+func splitLabel(label string) (path string, start, end, total int) {
+	m := lineRangeSuffix.FindStringSubmatch(label)
+	if m == nil {
+		return label, 0, 0, 0
+	}
+	start, _ = strconv.Atoi(m[2])
+	end, _ = strconv.Atoi(m[3])
+	total, _ = strconv.Atoi(m[4])
+	return m[1], start, end, total
+}
+
+func newBundleFile(label string, content string) BundleFile {
+	label = strings.TrimSpace(label)
+	label, lineNumbers := strings.CutSuffix(label, lineNumbersSuffix)
+	var transforms []string
+	if m := transformedSuffix.FindStringSubmatch(label); m != nil {
+		label = m[1]
+		transforms = strings.Split(m[2], ", ")
+	}
+	var originalSize int64
+	if m := truncatedSuffix.FindStringSubmatch(label); m != nil {
+		label = m[1]
+		originalSize, _ = strconv.ParseInt(m[2], 10, 64)
+	}
+	path, start, end, total := splitLabel(label)
+	return BundleFile{
+		Path:         path,
+		Content:      content,
+		Truncated:    originalSize > 0,
+		OriginalSize: originalSize,
+		Transforms:   transforms,
+		LineNumbers:  lineNumbers,
+		LineStart:    start,
+		LineEnd:      end,
+		TotalLines:   total,
+	}
+}
+
+func parseJSONBundle(data string) ([]BundleFile, error) {
+	var doc JSONDocument
+	if err := json.Unmarshal([]byte(data), &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse JSON bundle: %w", err)
+	}
+	files := make([]BundleFile, 0, len(doc.Files))
+	for _, record := range doc.Files {
+		files = append(files, bundleFileFromRecord(record))
+	}
+	return files, nil
+}
+
+func parseJSONLBundle(data string) ([]BundleFile, error) {
+	var files []BundleFile
+	scanner := bufio.NewScanner(strings.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 1<<30)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var record FileRecord
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			return nil, fmt.Errorf("failed to parse JSONL record on line %d: %w", lineNo, err)
+		}
+		if record.Path == "" { // A HeaderRecord or SkippedLineRecord
+			continue
+		}
+		files = append(files, bundleFileFromRecord(record))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read JSONL bundle: %w", err)
+	}
+	return files, nil
+}
+
+func bundleFileFromRecord(record FileRecord) BundleFile {
+	return BundleFile{
+		Path:         record.Path,
+		Content:      record.Content,
+		SHA256:       record.SHA256,
+		IsBinary:     record.Binary,
+		Truncated:    record.Truncated,
+		OriginalSize: record.OriginalSize,
+		Transforms:   record.Transforms,
+		LineNumbers:  record.LineNumbers,
+		LineStart:    record.LineStart,
+		LineEnd:      record.LineEnd,
+		TotalLines:   record.TotalLines,
+	}
+}
+
+// textStartMarker matches the start separator written by textRenderer.
+var textStartMarker = regexp.MustCompile(`(?m)^--- START FILE: (.+) ---\n`)
+
+func parseTextBundle(data string) ([]BundleFile, error) {
+	var files []BundleFile
+	pos := 0
+	for {
+		loc := textStartMarker.FindStringSubmatchIndex(data[pos:])
+		if loc == nil {
+			break
+		}
+		label := data[pos+loc[2] : pos+loc[3]]
+		contentStart := pos + loc[1]
+
+		endMarker := "\n--- END FILE: " + label + " ---"
+		endIdx := strings.Index(data[contentStart:], endMarker)
+		if endIdx < 0 {
+			// Tolerate a missing trailing newline before the end marker.
+			endMarker = "--- END FILE: " + label + " ---"
+			endIdx = strings.Index(data[contentStart:], endMarker)
+			if endIdx < 0 {
+				return nil, fmt.Errorf("missing end marker for file %s", label)
+			}
+		}
+		content := data[contentStart : contentStart+endIdx]
+		pos = contentStart + endIdx + len(endMarker)
+
+		if label == treeSectionName {
+			continue
+		}
+		files = append(files, newBundleFile(label, content))
+	}
+	return files, nil
+}
+
+// xmlDocumentStart matches the start of a <document> element written by
+// xmlRenderer, up to and including its <document_content> tag.
+var xmlDocumentStart = regexp.MustCompile(`(?s)<document(\s[^>]*)?>\s*<source>(.*?)</source>\s*<document_content>`)
+
+// xmlLinesAttr matches the line-range attributes of a partial document.
+var xmlLinesAttr = regexp.MustCompile(`lines="(\d+)-(\d+)"\s+total_lines="(\d+)"`)
+
+// xmlTruncatedAttr matches the attribute of a document cut off at the size
+// limit.
+var xmlTruncatedAttr = regexp.MustCompile(`truncated_from="(\d+)"`)
+
+// xmlTransformsAttr matches the attribute of a document rewritten by
+// --transform.
+var xmlTransformsAttr = regexp.MustCompile(`transforms="([a-z0-9,-]+)"`)
+
+// xmlLineNumbersAttr is the attribute of a document made with
+// --line-numbers.
+const xmlLineNumbersAttr = `line_numbers="true"`
+
+func parseXMLBundle(data string) ([]BundleFile, error) {
+	var files []BundleFile
+	pos := 0
+	for {
+		m := xmlDocumentStart.FindStringSubmatchIndex(data[pos:])
+		if m == nil {
+			break
+		}
+		attrs := ""
+		if m[2] >= 0 {
+			attrs = data[pos+m[2] : pos+m[3]]
+		}
+		path := html.UnescapeString(strings.TrimSpace(data[pos+m[4] : pos+m[5]]))
+
+		content, n, err := readXMLContent(data[pos+m[1]:])
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse document %s: %w", path, err)
+		}
+		pos += m[1] + n
+
+		file := BundleFile{Path: path, Content: content}
+		if lm := xmlLinesAttr.FindStringSubmatch(attrs); lm != nil {
+			file.LineStart, _ = strconv.Atoi(lm[1])
+			file.LineEnd, _ = strconv.Atoi(lm[2])
+			file.TotalLines, _ = strconv.Atoi(lm[3])
+		}
+		if tm := xmlTruncatedAttr.FindStringSubmatch(attrs); tm != nil {
+			file.OriginalSize, _ = strconv.ParseInt(tm[1], 10, 64)
+			file.Truncated = true
+		}
+		if tm := xmlTransformsAttr.FindStringSubmatch(attrs); tm != nil {
+			file.Transforms = strings.Split(tm[1], ",")
+		}
+		file.LineNumbers = strings.Contains(attrs, xmlLineNumbersAttr)
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+// readXMLContent reads document content up to the closing
+// </document_content> tag, joining CDATA sections and unescaping the text
+// between them. It returns the content and the number of bytes consumed.
+func readXMLContent(s string) (string, int, error) {
+	const cdataStart, cdataEnd, closeTag = "<![CDATA[", "]]>", "</document_content>"
+	var b strings.Builder
+	pos := 0
+	for {
+		next := strings.IndexByte(s[pos:], '<')
+		if next < 0 {
+			return "", 0, fmt.Errorf("missing %s", closeTag)
+		}
+		b.WriteString(html.UnescapeString(s[pos : pos+next]))
+		pos += next
+
+		switch {
+		case strings.HasPrefix(s[pos:], cdataStart):
+			pos += len(cdataStart)
+			end := strings.Index(s[pos:], cdataEnd)
+			if end < 0 {
+				return "", 0, fmt.Errorf("unterminated CDATA section")
+			}
+			b.WriteString(s[pos : pos+end])
+			pos += end + len(cdataEnd)
+		case strings.HasPrefix(s[pos:], closeTag):
+			return b.String(), pos + len(closeTag), nil
+		default:
+			// Stray markup in hand-edited content is kept as text.
+			b.WriteByte('<')
+			pos++
+		}
+	}
+}
+
+// markdownHeading matches a heading line that may name a file.
+var markdownHeading = regexp.MustCompile("^#{1,6}\\s+`?([^`]+?)`?\\s*$")
+
+// markdownFence matches an opening code fence and its info string.
+var markdownFence = regexp.MustCompile("^(`{3,}|~{3,})\\s*([^`]*)$")
+
+func parseMarkdownBundle(data string) ([]BundleFile, error) {
+	lines := strings.SplitAfter(data, "\n")
+	var files []BundleFile
+	for i := 0; i < len(lines); i++ {
+		hm := markdownHeading.FindStringSubmatch(strings.TrimRight(lines[i], "\r\n"))
+		if hm == nil {
+			continue
+		}
+		label := hm[1]
+
+		// The fence must follow the heading, separated only by blank lines.
+		j := i + 1
+		for j < len(lines) && strings.TrimSpace(lines[j]) == "" {
+			j++
+		}
+		if j >= len(lines) {
+			break
+		}
+		fm := markdownFence.FindStringSubmatch(strings.TrimRight(lines[j], "\r\n"))
+		if fm == nil {
+			continue
+		}
+		fence := fm[1]
+
+		var content strings.Builder
+		k := j + 1
+		closed := false
+		for ; k < len(lines); k++ {
+			trimmed := strings.TrimRight(lines[k], "\r\n")
+			if strings.HasPrefix(trimmed, fence) && strings.TrimLeft(trimmed, fence[:1]) == "" {
+				closed = true
+				break
+			}
+			content.WriteString(lines[k])
+		}
+		if !closed {
+			return nil, fmt.Errorf("unterminated code block for %s", label)
+		}
+		i = k
+
+		if strings.EqualFold(label, "Project Structure") {
+			continue
+		}
+		file := newBundleFile(label, content.String())
+		file.FinalNewlineUnknown = true
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+// JoinPartialFiles merges line-range slices of the same file, in order,
+// into one BundleFile. Whole files pass through unchanged. Slices that do
+// not make up the whole file stay marked as partial.
+func JoinPartialFiles(files []BundleFile) []BundleFile {
+	var result []BundleFile
+	partials := make(map[string][]BundleFile)
+	var order []string
+	for _, f := range files {
+		if f.TotalLines == 0 {
+			result = append(result, f)
+			continue
+		}
+		if _, seen := partials[f.Path]; !seen {
+			order = append(order, f.Path)
+		}
+		partials[f.Path] = append(partials[f.Path], f)
+	}
+
+	for _, path := range order {
+		slices := partials[path]
+		sort.SliceStable(slices, func(i, j int) bool { return slices[i].LineStart < slices[j].LineStart })
+
+		joined := BundleFile{Path: path, LineStart: slices[0].LineStart, TotalLines: slices[0].TotalLines}
+		var content strings.Builder
+		for _, s := range slices {
+			content.WriteString(s.Content)
+			joined.LineEnd = s.LineEnd
+			if s.Truncated {
+				joined.Truncated, joined.OriginalSize = true, s.OriginalSize
+			}
+			if len(s.Transforms) > 0 {
+				joined.Transforms = s.Transforms
+			}
+			joined.LineNumbers = joined.LineNumbers || s.LineNumbers
+			joined.FinalNewlineUnknown = s.FinalNewlineUnknown
+		}
+		joined.Content = content.String()
+		// A complete set of slices makes a whole file again.
+		if joined.LineStart == 1 && joined.LineEnd == joined.TotalLines {
+			joined.LineStart, joined.LineEnd, joined.TotalLines = 0, 0, 0
+		}
+		result = append(result, joined)
+	}
+	return result
+}
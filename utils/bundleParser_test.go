@@ -0,0 +1,130 @@
+package utils
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// bundleFormats are the formats ParseBundle reads back.
+var bundleFormats = []string{FormatText, FormatMarkdown, FormatXML, FormatJSON, FormatJSONL}
+
+// writeTestProject writes files, keyed by slash-separated path, into a
+// temporary directory and returns it with the files listed in path order.
+func writeTestProject(t *testing.T, files map[string]string) (string, []FileInfo) {
+	t.Helper()
+	root := t.TempDir()
+	paths := make([]string, 0, len(files))
+	for p := range files {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	var infos []FileInfo
+	for _, p := range paths {
+		abs := filepath.Join(root, filepath.FromSlash(p))
+		if err := os.MkdirAll(filepath.Dir(abs), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(abs, []byte(files[p]), 0644); err != nil {
+			t.Fatal(err)
+		}
+		infos = append(infos, FileInfo{AbsPath: abs, RelPath: filepath.FromSlash(p)})
+	}
+	return root, infos
+}
+
+// renderTestBundle renders files as a bundle in format.
+func renderTestBundle(t *testing.T, format string, files []FileInfo, opts RenderOptions) string {
+	t.Helper()
+	var b bytes.Buffer
+	r, err := NewRenderer(format, &b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc := DocumentInfo{ProjectName: "project", Header: "Read carefully."}
+	if err := RenderProject(r, doc, files, opts); err != nil {
+		t.Fatal(err)
+	}
+	return b.String()
+}
+
+func TestParseBundleRoundTrip(t *testing.T) {
+	files := map[string]string{
+		"main.go":          "package main\n\nfunc main() {}\n",
+		"README.md":        "# Title\n\n```go\nfmt.Println(\"fenced\")\n```\n\n~~~\ntilde\n~~~\n",
+		"web/index.html":   "<html><body>a &amp; b < c </document_content> ]]></body></html>\n",
+		"data/no-eol.txt":  "no newline at the end",
+		"data/empty.txt":   "",
+		"data/unicode.txt": "héllo wörld ✓\n",
+		"data/crlf.txt":    "one\r\ntwo\r\n",
+		"data/blank.txt":   "\n\nbetween\n\n",
+	}
+	_, infos := writeTestProject(t, files)
+
+	for _, format := range bundleFormats {
+		t.Run(format, func(t *testing.T) {
+			bundle := renderTestBundle(t, format, infos, RenderOptions{Tree: "project/\n└── main.go\n"})
+			parsed, detected, err := ParseBundle(bundle, "auto")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if detected != format {
+				t.Errorf("detected format %q, want %q", detected, format)
+			}
+			if len(parsed) != len(files) {
+				t.Fatalf("parsed %d files, want %d", len(parsed), len(files))
+			}
+			for _, f := range parsed {
+				want, ok := files[f.Path]
+				if !ok {
+					t.Errorf("unexpected file %q", f.Path)
+					continue
+				}
+				if f.FinalNewlineUnknown && want != "" && !strings.HasSuffix(want, "\n") {
+					want += "\n"
+				}
+				if f.Content != want {
+					t.Errorf("%s: content %q, want %q", f.Path, f.Content, want)
+				}
+				if (format == FormatJSON || format == FormatJSONL) && f.SHA256 != hashContent(want) {
+					t.Errorf("%s: hash %s, want %s", f.Path, f.SHA256, hashContent(want))
+				}
+			}
+		})
+	}
+}
+
+func TestParseBundleMarkers(t *testing.T) {
+	_, infos := writeTestProject(t, map[string]string{
+		"big.txt": "0123456789abcdef0123456789abcdef0123456789abcdef\n",
+		"a.go":    "package a\n\nfunc F() {\n\tprintln()\n}\n",
+	})
+	transform, err := NewTransformer([]string{TransformGoSkeleton}, TransformOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, format := range bundleFormats {
+		t.Run(format, func(t *testing.T) {
+			bundle := renderTestBundle(t, format, infos, RenderOptions{MaxFileSize: 40, Transform: transform})
+			parsed, _, err := ParseBundle(bundle, format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := make(map[string]BundleFile)
+			for _, f := range parsed {
+				got[f.Path] = f
+			}
+			if f := got["big.txt"]; !f.Truncated || f.OriginalSize != 49 || strings.TrimSuffix(f.Content, "\n") != "0123456789abcdef0123456789abcdef01234567" {
+				t.Errorf("big.txt: truncated %v from %d, content %q", f.Truncated, f.OriginalSize, f.Content)
+			}
+			if f := got["a.go"]; len(f.Transforms) != 1 || f.Transforms[0] != TransformGoSkeleton {
+				t.Errorf("a.go: transforms %v, want [%s]", f.Transforms, TransformGoSkeleton)
+			}
+		})
+	}
+}
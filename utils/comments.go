@@ -0,0 +1,787 @@
+package utils
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// commentSpan is the byte range [start, end) of a comment, without the
+// newline ending a line comment.
+type commentSpan struct{ start, end int }
+
+// commentLexers find the comments of a file by language (see
+// DetectLanguage). They step over string, character, raw and template
+// literals, so comment markers inside them are left alone. Languages
+// without a lexer keep their comments.
+var commentLexers = map[string]func(content string) []commentSpan{
+	"go":         cSyntax{lineComments: true, charLiterals: true, backtickRaw: true}.lex,
+	"c":          cSyntax{lineComments: true, charLiterals: true}.lex,
+	"objectivec": cSyntax{lineComments: true, charLiterals: true}.lex,
+	"cpp":        cSyntax{lineComments: true, charLiterals: true, cppRaw: true}.lex,
+	"csharp":     cSyntax{lineComments: true, charLiterals: true, tripleQuotes: true, verbatim: true}.lex,
+	"java":       cSyntax{lineComments: true, charLiterals: true, tripleQuotes: true}.lex,
+	"kotlin":     cSyntax{lineComments: true, charLiterals: true, tripleQuotes: true, nestedBlocks: true}.lex,
+	"scala":      cSyntax{lineComments: true, charLiterals: true, tripleQuotes: true, nestedBlocks: true}.lex,
+	"swift":      cSyntax{lineComments: true, tripleQuotes: true, nestedBlocks: true}.lex,
+	"groovy":     cSyntax{lineComments: true, tripleQuotes: true}.lex,
+	"dart":       cSyntax{lineComments: true, tripleQuotes: true, nestedBlocks: true}.lex,
+	"rust":       cSyntax{lineComments: true, charLiterals: true, nestedBlocks: true, rustRaw: true}.lex,
+	"javascript": cSyntax{lineComments: true, templates: true, regexLiterals: true}.lex,
+	"jsx":        cSyntax{lineComments: true, templates: true, regexLiterals: true}.lex,
+	"typescript": cSyntax{lineComments: true, templates: true, regexLiterals: true}.lex,
+	"tsx":        cSyntax{lineComments: true, templates: true, regexLiterals: true}.lex,
+	"protobuf":   cSyntax{lineComments: true}.lex,
+	"css":        cSyntax{cssURLs: true}.lex,
+	"scss":       cSyntax{lineComments: true, cssURLs: true}.lex,
+	"less":       cSyntax{lineComments: true, cssURLs: true}.lex,
+	"python":     lexPythonComments,
+	"bash":       lexShellComments,
+	"zsh":        lexShellComments,
+	"sql":        lexSQLComments,
+	"html":       lexMarkupComments,
+	"xml":        lexMarkupComments,
+	"yaml":       lexYAMLComments,
+	"dockerfile": lexDockerfileComments,
+	"makefile":   lexLineStartComments,
+}
+
+// licenseHeader matches the text of a comment that states a license or
+// copyright.
+var licenseHeader = regexp.MustCompile(`(?i)copyright|licen[cs]e|spdx-license-identifier|\(c\) \d{4}`)
+
+// goKeptComment matches Go comments that are directives rather than prose.
+var goKeptComment = regexp.MustCompile(`^//(go:|line |export |extern |\s*\+build )`)
+
+// stripComments removes the comments of content, written in language.
+// Lines left empty by it are dropped altogether. With keepLicense, a
+// leading comment block that mentions a license or copyright is kept.
+func stripComments(content, language string, keepLicense bool) (string, error) {
+	lex := commentLexers[language]
+	if lex == nil {
+		return content, nil
+	}
+	spans := lex(content)
+	if language == "go" {
+		spans = keepGoDirectives(content, spans)
+	}
+	if keepLicense {
+		spans = keepLicenseHeader(content, spans)
+	}
+	// Markup comments sit in text, where removing one joins what was
+	// around it.
+	separate := language != "html" && language != "xml"
+	return removeSpans(content, spans, separate), nil
+}
+
+// hasCommentLexer reports whether stripComments knows the language.
+func hasCommentLexer(language string) bool {
+	return commentLexers[language] != nil
+}
+
+// cgoImport matches the import of the cgo pseudo-package.
+var cgoImport = regexp.MustCompile(`(?m)^import "C"`)
+
+// keepGoDirectives drops compiler directives and cgo preambles (the comment
+// group right above import "C") from spans.
+func keepGoDirectives(content string, spans []commentSpan) []commentSpan {
+	preamble := make(map[int]bool)
+	for _, loc := range cgoImport.FindAllStringIndex(content, -1) {
+		next := loc[0]
+		for j := len(spans) - 1; j >= 0; j-- {
+			if spans[j].end > next {
+				continue
+			}
+			gap := content[spans[j].end:next]
+			if strings.TrimSpace(gap) != "" || strings.Count(gap, "\n") > 1 {
+				break
+			}
+			preamble[j] = true
+			next = spans[j].start
+		}
+	}
+
+	var kept []commentSpan
+	for i, span := range spans {
+		if !preamble[i] && !goKeptComment.MatchString(content[span.start:span.end]) {
+			kept = append(kept, span)
+		}
+	}
+	return kept
+}
+
+// keepLicenseHeader drops from spans the leading comment blocks (comments
+// separated by no more than a line break, before any code) that mention a
+// license or copyright.
+func keepLicenseHeader(content string, spans []commentSpan) []commentSpan {
+	// Find the leading comments and group them into blocks
+	var blocks [][]commentSpan
+	prev := 0
+	if strings.HasPrefix(content, "#!") {
+		if nl := strings.IndexByte(content, '\n'); nl >= 0 {
+			prev = nl
+		}
+	}
+	n := 0
+	for ; n < len(spans); n++ {
+		gap := content[prev:spans[n].start]
+		if strings.TrimSpace(gap) != "" {
+			break
+		}
+		if len(blocks) == 0 || strings.Count(gap, "\n") > 1 {
+			blocks = append(blocks, nil)
+		}
+		blocks[len(blocks)-1] = append(blocks[len(blocks)-1], spans[n])
+		prev = spans[n].end
+	}
+
+	var kept []commentSpan
+	for _, block := range blocks {
+		if !licenseHeader.MatchString(content[block[0].start:block[len(block)-1].end]) {
+			kept = append(kept, block...)
+		}
+	}
+	return append(kept, spans[n:]...)
+}
+
+// removeSpans cuts the sorted, non-overlapping spans out of content. A line
+// with nothing but whitespace left is dropped together with its line break;
+// other lines lose the whitespace around a removed comment. Where a comment
+// separated two words and separate is set, a space is put in its place.
+// Blank lines left at the start, e.g. below a removed file header, are
+// dropped.
+func removeSpans(content string, spans []commentSpan, separate bool) string {
+	if len(spans) == 0 {
+		return content
+	}
+	var b, line strings.Builder
+	b.Grow(len(content))
+	next := 0 // First span not yet behind the current line
+	for lineStart := 0; lineStart < len(content); {
+		lineEnd := nextLine(content, lineStart)
+		for next < len(spans) && spans[next].end <= lineStart {
+			next++
+		}
+		if next == len(spans) || spans[next].start >= lineEnd {
+			b.WriteString(content[lineStart:lineEnd])
+			lineStart = lineEnd
+			continue
+		}
+
+		line.Reset()
+		pos := lineStart
+		for k := next; k < len(spans) && spans[k].start < lineEnd; k++ {
+			if spans[k].start > pos {
+				line.WriteString(content[pos:spans[k].start])
+			}
+			pos = max(pos, min(spans[k].end, lineEnd))
+			text := line.String()
+			switch {
+			case pos == lineEnd:
+			case text == "" || text[len(text)-1] == ' ' || text[len(text)-1] == '\t':
+				for pos < lineEnd && (content[pos] == ' ' || content[pos] == '\t') {
+					pos++
+				}
+			case separate && isIdentByte(text[len(text)-1]) && isIdentByte(content[pos]):
+				line.WriteByte(' ')
+			}
+		}
+		line.WriteString(content[pos:lineEnd])
+
+		body := strings.TrimRight(line.String(), " \t\r\n")
+		if strings.TrimSpace(body) != "" {
+			b.WriteString(body)
+			b.WriteString(lineEnding(content[lineStart:lineEnd]))
+		}
+		lineStart = lineEnd
+	}
+	return strings.TrimLeft(b.String(), "\r\n")
+}
+
+// lineEnding returns the "\n" or "\r\n" ending line, if any.
+func lineEnding(line string) string {
+	switch {
+	case strings.HasSuffix(line, "\r\n"):
+		return "\r\n"
+	case strings.HasSuffix(line, "\n"):
+		return "\n"
+	}
+	return ""
+}
+
+func isSpaceByte(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
+
+func isIdentByte(c byte) bool {
+	return c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= utf8.RuneSelf
+}
+
+// lineCommentEnd returns the end of a comment starting at i and running to
+// the end of the line.
+func lineCommentEnd(s string, i int) int {
+	if nl := strings.IndexByte(s[i:], '\n'); nl >= 0 {
+		end := i + nl
+		if end > i && s[end-1] == '\r' {
+			end--
+		}
+		return end
+	}
+	return len(s)
+}
+
+// quotedEnd returns the index after the quote closing a string opened by
+// s[i], honouring backslash escapes. Unterminated strings end at the line
+// break, so that a stray quote cannot hide the rest of the file.
+func quotedEnd(s string, i int, multiline bool) int {
+	q := s[i]
+	for j := i + 1; j < len(s); j++ {
+		switch s[j] {
+		case '\\':
+			j++
+		case q:
+			return j + 1
+		case '\n':
+			if !multiline {
+				return j
+			}
+		}
+	}
+	return len(s)
+}
+
+// delimitedEnd returns the index after the first close at or after i, or
+// the end of s.
+func delimitedEnd(s string, i int, close string) int {
+	if idx := strings.Index(s[i:], close); idx >= 0 {
+		return i + idx + len(close)
+	}
+	return len(s)
+}
+
+// cSyntax describes a language with C-style "/* */" comments.
+type cSyntax struct {
+	lineComments  bool // "//" comments
+	nestedBlocks  bool // Block comments nest (Rust, Swift, Kotlin, Scala, Dart)
+	charLiterals  bool // '' holds one character; otherwise it is a string
+	tripleQuotes  bool // """text blocks""" (and ''' where '' is a string)
+	backtickRaw   bool // `raw strings` without escapes (Go)
+	templates     bool // `template ${literals}` (JavaScript, TypeScript)
+	regexLiterals bool // /regular expressions/ (JavaScript, TypeScript)
+	cppRaw        bool // R"delim(raw strings)delim" (C++)
+	rustRaw       bool // r#"raw strings"# (Rust)
+	verbatim      bool // @"verbatim strings" with "" escapes (C#)
+	cssURLs       bool // Unquoted url(...) values may contain "//"
+}
+
+func (syn cSyntax) lex(content string) []commentSpan {
+	l := &cLexer{syn: syn, s: content}
+	l.code(0, false)
+	return l.spans
+}
+
+type cLexer struct {
+	syn   cSyntax
+	s     string
+	spans []commentSpan
+}
+
+// code scans code from i to the end of the input or, in a template
+// substitution, to just after its closing brace, and returns where it
+// stopped.
+func (l *cLexer) code(i int, inTemplate bool) int {
+	s, syn := l.s, l.syn
+	depth := 0
+	for i < len(s) {
+		c := s[i]
+		switch {
+		case c == '/' && strings.HasPrefix(s[i:], "//") && syn.lineComments:
+			end := lineCommentEnd(s, i)
+			l.spans = append(l.spans, commentSpan{i, end})
+			i = end
+		case c == '/' && strings.HasPrefix(s[i:], "/*"):
+			end := l.blockEnd(i)
+			l.spans = append(l.spans, commentSpan{i, end})
+			i = end
+		case c == '/' && syn.regexLiterals && regexAllowed(s, i):
+			i = regexEnd(s, i)
+		case c == '"' || c == '\'' && !syn.charLiterals:
+			i = l.stringEnd(i)
+		case c == '\'':
+			i = charLiteralEnd(s, i)
+		case c == '`' && syn.backtickRaw:
+			i = delimitedEnd(s, i+1, "`")
+		case c == '`' && syn.templates:
+			i = l.templateEnd(i)
+		case c == 'r' && syn.rustRaw && rustRawStart(s, i):
+			i = rustRawEnd(s, i)
+		case syn.cssURLs && (c == 'u' || c == 'U') && i+4 <= len(s) && strings.EqualFold(s[i:i+4], "url(") && (i == 0 || !isIdentByte(s[i-1])):
+			i = delimitedEnd(s, i+4, ")")
+		case inTemplate && c == '{':
+			depth++
+			i++
+		case inTemplate && c == '}':
+			if depth == 0 {
+				return i + 1
+			}
+			depth--
+			i++
+		default:
+			i++
+		}
+	}
+	return i
+}
+
+// blockEnd returns the end of the block comment starting at i.
+func (l *cLexer) blockEnd(i int) int {
+	s := l.s
+	if !l.syn.nestedBlocks {
+		return delimitedEnd(s, i+2, "*/")
+	}
+	depth := 0
+	for j := i; j+1 < len(s); j++ {
+		switch {
+		case s[j] == '/' && s[j+1] == '*':
+			depth++
+			j++
+		case s[j] == '*' && s[j+1] == '/':
+			depth--
+			j++
+			if depth == 0 {
+				return j + 1
+			}
+		}
+	}
+	return len(s)
+}
+
+// stringEnd returns the end of the string literal starting at i.
+func (l *cLexer) stringEnd(i int) int {
+	s, syn := l.s, l.syn
+	q := s[i]
+	switch {
+	case syn.tripleQuotes && strings.HasPrefix(s[i:], strings.Repeat(string(q), 3)):
+		return tripleQuotedEnd(s, i)
+	case syn.verbatim && q == '"' && i > 0 && s[i-1] == '@':
+		for j := i + 1; j < len(s); j++ {
+			if s[j] == '"' {
+				if j+1 < len(s) && s[j+1] == '"' {
+					j++
+					continue
+				}
+				return j + 1
+			}
+		}
+		return len(s)
+	case syn.cppRaw && q == '"' && i > 0 && s[i-1] == 'R':
+		if open := strings.IndexByte(s[i+1:], '('); open >= 0 && open <= 16 && !strings.ContainsAny(s[i+1:i+1+open], " \\\t\n)") {
+			return delimitedEnd(s, i+2+open, ")"+s[i+1:i+1+open]+`"`)
+		}
+	}
+	return quotedEnd(s, i, false)
+}
+
+// templateEnd returns the end of the template literal starting at i,
+// scanning the code of ${} substitutions for nested literals.
+func (l *cLexer) templateEnd(i int) int {
+	s := l.s
+	for j := i + 1; j < len(s); {
+		switch {
+		case s[j] == '\\':
+			j += 2
+		case s[j] == '`':
+			return j + 1
+		case strings.HasPrefix(s[j:], "${"):
+			j = l.code(j+2, true)
+		default:
+			j++
+		}
+	}
+	return len(s)
+}
+
+// tripleQuotedEnd returns the end of the triple-quoted string starting at
+// i.
+func tripleQuotedEnd(s string, i int) int {
+	close := s[i : i+3]
+	for j := i + 3; j < len(s); j++ {
+		if s[j] == '\\' {
+			j++
+			continue
+		}
+		if strings.HasPrefix(s[j:], close) {
+			// Quotes right before the closing ones belong to the string.
+			for j+3 < len(s) && s[j+3] == close[0] {
+				j++
+			}
+			return j + 3
+		}
+	}
+	return len(s)
+}
+
+// charLiteralEnd returns the end of the character literal starting at i,
+// or i+1 if the quote does not start one, e.g. a Rust lifetime or a C++
+// digit separator.
+func charLiteralEnd(s string, i int) int {
+	j := i + 1
+	if j < len(s) && s[j] == '\\' {
+		for j += 2; j < len(s) && j < i+12 && s[j] != '\'' && s[j] != '\n'; j++ {
+		}
+	} else if j < len(s) {
+		_, size := utf8.DecodeRuneInString(s[j:])
+		j += size
+	}
+	if j < len(s) && s[j] == '\'' {
+		return j + 1
+	}
+	return i + 1
+}
+
+// regexAllowed reports whether a '/' at i starts a regular expression
+// literal rather than a division, judging by the code before it.
+func regexAllowed(s string, i int) bool {
+	j := i - 1
+	for j >= 0 && isSpaceByte(s[j]) {
+		j--
+	}
+	if j < 0 {
+		return true
+	}
+	if isIdentByte(s[j]) {
+		k := j
+		for k >= 0 && isIdentByte(s[k]) {
+			k--
+		}
+		switch s[k+1 : j+1] {
+		case "return", "typeof", "instanceof", "in", "of", "new", "delete", "void", "throw", "case", "do", "else", "yield", "await":
+			return true
+		}
+		return false
+	}
+	return !strings.ContainsRune(")]}\"'`", rune(s[j]))
+}
+
+// regexEnd returns the end of the regular expression literal starting at
+// i, or i+1 if it does not end on the same line.
+func regexEnd(s string, i int) int {
+	inClass := false
+	for j := i + 1; j < len(s); j++ {
+		switch s[j] {
+		case '\\':
+			j++
+		case '[':
+			inClass = true
+		case ']':
+			inClass = false
+		case '/':
+			if !inClass {
+				return j + 1
+			}
+		case '\n':
+			return i + 1
+		}
+	}
+	return i + 1
+}
+
+// rustRawStart reports whether a raw string (r"", r#""#, br"") starts at
+// the 'r' at i.
+func rustRawStart(s string, i int) bool {
+	if i > 0 && isIdentByte(s[i-1]) && !(s[i-1] == 'b' && (i < 2 || !isIdentByte(s[i-2]))) {
+		return false
+	}
+	j := i + 1
+	for j < len(s) && s[j] == '#' {
+		j++
+	}
+	return j < len(s) && s[j] == '"'
+}
+
+func rustRawEnd(s string, i int) int {
+	j := i + 1
+	for j < len(s) && s[j] == '#' {
+		j++
+	}
+	return delimitedEnd(s, j+1, `"`+s[i+1:j])
+}
+
+// lexPythonComments finds "#" comments, stepping over single- and
+// triple-quoted strings. Docstrings are strings and are kept.
+func lexPythonComments(s string) []commentSpan {
+	var spans []commentSpan
+	for i := 0; i < len(s); {
+		switch c := s[i]; {
+		case c == '#':
+			end := lineCommentEnd(s, i)
+			if !(i == 0 && strings.HasPrefix(s, "#!")) {
+				spans = append(spans, commentSpan{i, end})
+			}
+			i = end
+		case c == '"' || c == '\'':
+			if strings.HasPrefix(s[i:], strings.Repeat(string(c), 3)) {
+				i = tripleQuotedEnd(s, i)
+			} else {
+				i = quotedEnd(s, i, false)
+			}
+		default:
+			i++
+		}
+	}
+	return spans
+}
+
+// heredocStart matches a here-document operator and its delimiter.
+var heredocStart = regexp.MustCompile(`^<<(-?)[ \t]*(?:'([^'\n]+)'|"([^"\n]+)"|\\?([A-Za-z_][A-Za-z0-9_]*))`)
+
+// lexShellComments finds "#" comments that start a word, stepping over
+// quotes, escapes and here-documents. The shebang line is kept.
+func lexShellComments(s string) []commentSpan {
+	var spans []commentSpan
+	type heredoc struct {
+		delim string
+		tabs  bool
+	}
+	var pending []heredoc
+	for i := 0; i < len(s); {
+		switch c := s[i]; {
+		case c == '#' && (i == 0 || strings.IndexByte(" \t\n;&|()", s[i-1]) >= 0):
+			end := lineCommentEnd(s, i)
+			if !(i == 0 && strings.HasPrefix(s, "#!")) {
+				spans = append(spans, commentSpan{i, end})
+			}
+			i = end
+		case c == '\\':
+			i += 2
+		case c == '\'':
+			if i > 0 && s[i-1] == '$' {
+				i = quotedEnd(s, i, true)
+			} else {
+				i = delimitedEnd(s, i+1, "'")
+			}
+		case c == '"':
+			i = quotedEnd(s, i, true)
+		case c == '<' && strings.HasPrefix(s[i:], "<<") && !strings.HasPrefix(s[i:], "<<<"):
+			if m := heredocStart.FindStringSubmatch(s[i:]); m != nil {
+				pending = append(pending, heredoc{delim: m[2] + m[3] + m[4], tabs: m[1] == "-"})
+				i += len(m[0])
+			} else {
+				i += 2
+			}
+		case c == '\n' && len(pending) > 0:
+			// Here-document bodies follow the line that opened them
+			i++
+			for _, doc := range pending {
+				for i < len(s) {
+					end := strings.IndexByte(s[i:], '\n')
+					if end < 0 {
+						end = len(s) - i
+					}
+					line := strings.TrimRight(s[i:i+end], "\r")
+					if doc.tabs {
+						line = strings.TrimLeft(line, "\t")
+					}
+					i = min(i+end+1, len(s))
+					if line == doc.delim {
+						break
+					}
+				}
+			}
+			pending = pending[:0]
+		default:
+			i++
+		}
+	}
+	return spans
+}
+
+// lexSQLComments finds "--" and "/* */" comments, stepping over quoted
+// strings and identifiers and PostgreSQL dollar-quoted strings.
+func lexSQLComments(s string) []commentSpan {
+	var spans []commentSpan
+	for i := 0; i < len(s); {
+		switch c := s[i]; {
+		case c == '-' && strings.HasPrefix(s[i:], "--"):
+			end := lineCommentEnd(s, i)
+			spans = append(spans, commentSpan{i, end})
+			i = end
+		case c == '/' && strings.HasPrefix(s[i:], "/*"):
+			end := delimitedEnd(s, i+2, "*/")
+			spans = append(spans, commentSpan{i, end})
+			i = end
+		case c == '\'' || c == '"' || c == '`':
+			// Quotes are escaped by doubling them
+			j := i + 1
+			for j < len(s) {
+				if s[j] == c {
+					if j+1 < len(s) && s[j+1] == c {
+						j += 2
+						continue
+					}
+					j++
+					break
+				}
+				j++
+			}
+			i = j
+		case c == '$' && (i == 0 || !isIdentByte(s[i-1])):
+			j := i + 1
+			for j < len(s) && isIdentByte(s[j]) && !(j == i+1 && s[j] >= '0' && s[j] <= '9') {
+				j++
+			}
+			if j < len(s) && s[j] == '$' {
+				i = delimitedEnd(s, j+1, s[i:j+1])
+			} else {
+				i = j
+			}
+		default:
+			i++
+		}
+	}
+	return spans
+}
+
+// lexMarkupComments finds "<!-- -->" comments in HTML and XML, stepping over
+// CDATA sections and quoted attribute values.
+func lexMarkupComments(s string) []commentSpan {
+	var spans []commentSpan
+	for i := 0; i < len(s); {
+		switch {
+		case strings.HasPrefix(s[i:], "<!--"):
+			end := delimitedEnd(s, i+4, "-->")
+			spans = append(spans, commentSpan{i, end})
+			i = end
+		case strings.HasPrefix(s[i:], "<![CDATA["):
+			i = delimitedEnd(s, i+9, "]]>")
+		case s[i] == '<':
+			// A tag, whose attribute values may hold anything but their quote
+			j := i + 1
+			for j < len(s) && s[j] != '>' && s[j] != '<' {
+				if s[j] == '"' || s[j] == '\'' {
+					j = delimitedEnd(s, j+1, string(s[j]))
+					continue
+				}
+				j++
+			}
+			i = j
+		default:
+			i++
+		}
+	}
+	return spans
+}
+
+// yamlBlockScalar matches the end of a line that starts a literal or folded
+// block scalar.
+var yamlBlockScalar = regexp.MustCompile(`(^|\s)[|>][+-]?[1-9]?[+-]?\s*$`)
+
+// lexYAMLComments finds "#" comments that start a line or follow
+// whitespace, stepping over quoted scalars and the content of block
+// scalars.
+func lexYAMLComments(s string) []commentSpan {
+	var spans []commentSpan
+	blockIndent := -1 // Indentation of the line that opened a block scalar
+	var quote byte    // Quote of a scalar continuing on the next line
+	for lineStart := 0; lineStart < len(s); {
+		lineEnd := lineCommentEnd(s, lineStart)
+		line := s[lineStart:lineEnd]
+		indent := len(line) - len(strings.TrimLeft(line, " "))
+
+		if blockIndent >= 0 {
+			if strings.TrimSpace(line) == "" || indent > blockIndent {
+				lineStart = nextLine(s, lineEnd)
+				continue
+			}
+			blockIndent = -1
+		}
+
+		code := len(line)
+		for i := 0; i < len(line); i++ {
+			c := line[i]
+			if quote != 0 {
+				switch {
+				case c == '\\' && quote == '"':
+					i++
+				case c == quote && quote == '\'' && i+1 < len(line) && line[i+1] == '\'':
+					i++
+				case c == quote:
+					quote = 0
+				}
+				continue
+			}
+			switch {
+			case c == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+				spans = append(spans, commentSpan{lineStart + i, lineEnd})
+				code = i
+				i = len(line)
+			case (c == '"' || c == '\'') && yamlScalarStart(line, i):
+				quote = c
+			}
+		}
+		if quote == 0 && yamlBlockScalar.MatchString(line[:code]) {
+			blockIndent = indent
+		}
+		lineStart = nextLine(s, lineEnd)
+	}
+	return spans
+}
+
+// yamlScalarStart reports whether a quote at i opens a quoted scalar: it
+// must start the value, not sit inside a plain one like "it's".
+func yamlScalarStart(line string, i int) bool {
+	j := i - 1
+	for j >= 0 && line[j] == ' ' {
+		j--
+	}
+	if j < 0 {
+		return true
+	}
+	switch line[j] {
+	case '[', '{', ',':
+		return true
+	case ':', '-', '?':
+		return j < i-1
+	}
+	return false
+}
+
+// nextLine returns the start of the line after the one holding i.
+func nextLine(s string, i int) int {
+	if nl := strings.IndexByte(s[i:], '\n'); nl >= 0 {
+		return i + nl + 1
+	}
+	return len(s)
+}
+
+// dockerfileDirective matches a parser directive, a comment that Docker
+// reads at the very top of a Dockerfile.
+var dockerfileDirective = regexp.MustCompile(`(?i)^#\s*(syntax|escape|check)\s*=`)
+
+// lexDockerfileComments finds whole-line comments like lexLineStartComments,
+// except for the parser directives that open the file.
+func lexDockerfileComments(s string) []commentSpan {
+	spans := lexLineStartComments(s)
+	prev := 0
+	for len(spans) > 0 && strings.TrimSpace(s[prev:spans[0].start]) == "" && dockerfileDirective.MatchString(s[spans[0].start:spans[0].end]) {
+		prev = spans[0].end
+		spans = spans[1:]
+	}
+	return spans
+}
+
+// lexLineStartComments finds "#" comments that take up a whole line, as in
+// Dockerfiles, Makefiles and ignore files, where "#" later in a line is
+// usually part of the text.
+func lexLineStartComments(s string) []commentSpan {
+	var spans []commentSpan
+	for lineStart := 0; lineStart < len(s); {
+		lineEnd := lineCommentEnd(s, lineStart)
+		trimmed := strings.TrimLeft(s[lineStart:lineEnd], " \t")
+		if strings.HasPrefix(trimmed, "#") && !(lineStart == 0 && strings.HasPrefix(trimmed, "#!")) {
+			spans = append(spans, commentSpan{lineEnd - len(trimmed), lineEnd})
+		}
+		lineStart = nextLine(s, lineEnd)
+	}
+	return spans
+}
@@ -0,0 +1,222 @@
+package utils
+
+import "testing"
+
+func TestStripComments(t *testing.T) {
+	tests := []struct {
+		name        string
+		language    string
+		keepLicense bool
+		in, want    string
+	}{
+		{
+			name:     "go",
+			language: "go",
+			in:       "// Package p does things.\npackage p\n\nimport \"fmt\" // fmt\n\nvar s = \"// not a comment\" /* block */\nvar r = `/* raw */`\nvar c = '/'\n",
+			want:     "package p\n\nimport \"fmt\"\n\nvar s = \"// not a comment\"\nvar r = `/* raw */`\nvar c = '/'\n",
+		},
+		{
+			name:     "go directives",
+			language: "go",
+			in:       "package p\n\n//go:generate stringer -type T\n// T is a thing.\ntype T int\n",
+			want:     "package p\n\n//go:generate stringer -type T\ntype T int\n",
+		},
+		{
+			name:     "go cgo preamble",
+			language: "go",
+			in:       "package p\n\n// #include <stdio.h>\nimport \"C\"\n",
+			want:     "package p\n\n// #include <stdio.h>\nimport \"C\"\n",
+		},
+		{
+			name:     "c",
+			language: "c",
+			in:       "#include <x.h> /* hdr */\nint a = 1; // one\nchar q = '\"'; /* multi\n line */\nchar *s = \"/* no */\";\n",
+			want:     "#include <x.h>\nint a = 1;\nchar q = '\"';\nchar *s = \"/* no */\";\n",
+		},
+		{
+			name:     "comment between words",
+			language: "c",
+			in:       "unsigned/**/int x;\n",
+			want:     "unsigned int x;\n",
+		},
+		{
+			name:     "cpp raw string",
+			language: "cpp",
+			in:       "auto s = R\"(// raw)\"; // gone\n",
+			want:     "auto s = R\"(// raw)\";\n",
+		},
+		{
+			name:     "csharp verbatim and raw strings",
+			language: "csharp",
+			in:       "var p = @\"C:\\// dir\"; // c\nvar r = \"\"\"\n// raw\n\"\"\";\n",
+			want:     "var p = @\"C:\\// dir\";\nvar r = \"\"\"\n// raw\n\"\"\";\n",
+		},
+		{
+			name:     "java escapes",
+			language: "java",
+			in:       "char c = '\\''; // c\nString s = \"\\\"// no\";\n",
+			want:     "char c = '\\'';\nString s = \"\\\"// no\";\n",
+		},
+		{
+			name:     "kotlin nested block and raw string",
+			language: "kotlin",
+			in:       "/* a /* b */ c */ val x = \"\"\"// raw\"\"\"\n",
+			want:     "val x = \"\"\"// raw\"\"\"\n",
+		},
+		{
+			name:     "swift",
+			language: "swift",
+			in:       "/* a /* b */ */ let s = \"// no\" // c\n",
+			want:     "let s = \"// no\"\n",
+		},
+		{
+			name:     "rust",
+			language: "rust",
+			in:       "/* outer /* nested */ still */ fn main() {} // x\nlet s = r#\"// raw\"#;\n",
+			want:     "fn main() {}\nlet s = r#\"// raw\"#;\n",
+		},
+		{
+			name:     "javascript regex and template literals",
+			language: "javascript",
+			in:       "const re = /\\/\\/ not/g; // real\nconst t = `// ${a /* in expr */}`;\nconst d = a / b; // div\n",
+			want:     "const re = /\\/\\/ not/g;\nconst t = `// ${a }`;\nconst d = a / b;\n",
+		},
+		{
+			name:     "typescript doc comment",
+			language: "typescript",
+			in:       "/** Doc. */\nlet x: number = 1; /** doc */\n",
+			want:     "let x: number = 1;\n",
+		},
+		{
+			name:     "css url",
+			language: "css",
+			in:       "a { background: url(//cdn.x/y.png); } /* c */\n",
+			want:     "a { background: url(//cdn.x/y.png); }\n",
+		},
+		{
+			name:     "scss line comment",
+			language: "scss",
+			in:       "// vars\n$a: 1; // line\n",
+			want:     "$a: 1;\n",
+		},
+		{
+			name:     "python",
+			language: "python",
+			in:       "#!/usr/bin/env python\n# comment\nx = \"# no\" # yes\ns = '''\n# kept\n'''\n",
+			want:     "#!/usr/bin/env python\nx = \"# no\"\ns = '''\n# kept\n'''\n",
+		},
+		{
+			name:     "bash",
+			language: "bash",
+			in:       "#!/bin/sh\n# c\necho \"# no\" # yes\necho a#b\ncat <<EOF\n# kept\nEOF\n",
+			want:     "#!/bin/sh\necho \"# no\"\necho a#b\ncat <<EOF\n# kept\nEOF\n",
+		},
+		{
+			name:     "sql",
+			language: "sql",
+			in:       "SELECT '-- no' -- yes\n/* b */ FROM t; $$ -- kept $$\n",
+			want:     "SELECT '-- no'\nFROM t; $$ -- kept $$\n",
+		},
+		{
+			name:     "html",
+			language: "html",
+			in:       "<p>a<!-- c -->b</p>\n<!--\nmulti\n-->\n<script>x</script>\n",
+			want:     "<p>ab</p>\n<script>x</script>\n",
+		},
+		{
+			name:     "xml cdata",
+			language: "xml",
+			in:       "<?xml version=\"1.0\"?>\n<!-- c -->\n<a><![CDATA[<!-- kept -->]]></a>\n",
+			want:     "<?xml version=\"1.0\"?>\n<a><![CDATA[<!-- kept -->]]></a>\n",
+		},
+		{
+			name:     "yaml",
+			language: "yaml",
+			in:       "# c\nkey: value # yes\nurl: http://x#frag\nquoted: '#b'\ntext: |\n  # kept\n  line\n",
+			want:     "key: value\nurl: http://x#frag\nquoted: '#b'\ntext: |\n  # kept\n  line\n",
+		},
+		{
+			name:     "dockerfile parser directives",
+			language: "dockerfile",
+			in:       "# syntax=docker/dockerfile:1\n# escape=`\n# c\nFROM x\nRUN echo # kept\n# check=skip\n",
+			want:     "# syntax=docker/dockerfile:1\n# escape=`\nFROM x\nRUN echo # kept\n",
+		},
+		{
+			name:     "makefile",
+			language: "makefile",
+			in:       "# c\nall:\n\techo # kept\n",
+			want:     "all:\n\techo # kept\n",
+		},
+		{
+			name:     "unknown language",
+			language: "text",
+			in:       "# not a comment here\n",
+			want:     "# not a comment here\n",
+		},
+		{
+			name:        "keep go license",
+			language:    "go",
+			keepLicense: true,
+			in:          "// Copyright 2024 X\n// SPDX-License-Identifier: MIT\n\n// Package p.\npackage p // p\n",
+			want:        "// Copyright 2024 X\n// SPDX-License-Identifier: MIT\n\npackage p\n",
+		},
+		{
+			name:        "keep license below package doc",
+			language:    "go",
+			keepLicense: true,
+			in:          "// Package p.\n\n// Copyright 2020\npackage p\n",
+			want:        "// Copyright 2020\npackage p\n",
+		},
+		{
+			name:        "keep python license after shebang",
+			language:    "python",
+			keepLicense: true,
+			in:          "#!/usr/bin/env python\n# Copyright (c) 2020 Y\n# Licensed under MIT\n\n# note\nx = 1  # c\n",
+			want:        "#!/usr/bin/env python\n# Copyright (c) 2020 Y\n# Licensed under MIT\n\nx = 1\n",
+		},
+		{
+			name:        "keep java block license",
+			language:    "java",
+			keepLicense: true,
+			in:          "/*\n * Copyright 2020 Z\n */\npackage a; // x\n",
+			want:        "/*\n * Copyright 2020 Z\n */\npackage a;\n",
+		},
+		{
+			name:        "keep license drops other headers",
+			language:    "java",
+			keepLicense: true,
+			in:          "/* helper */\nclass A {}\n",
+			want:        "class A {}\n",
+		},
+		{
+			name:        "license later in the file",
+			language:    "c",
+			keepLicense: true,
+			in:          "int a;\n/* Copyright 2020 */\nint b;\n",
+			want:        "int a;\nint b;\n",
+		},
+		{
+			name:     "license without keep-license",
+			language: "go",
+			in:       "// Copyright 2024 X\n\npackage p\n",
+			want:     "package p\n",
+		},
+		{
+			name:     "crlf line endings",
+			language: "c",
+			in:       "// c\r\nint a; // x\r\nint b;\r\n",
+			want:     "int a;\r\nint b;\r\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := stripComments(tt.in, tt.language, tt.keepLicense)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("stripComments(%q)\n got %q\nwant %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
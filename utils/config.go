@@ -0,0 +1,190 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigFileName is the project configuration file, searched for upward
+// from the project directory.
+const ConfigFileName = ".como.yaml"
+
+// FlagValues maps flag names (without dashes) to values: a string, number,
+// boolean or list. A key whose value is itself a map names a command, and
+// its values apply to that command only, e.g.
+//
+//	format: markdown
+//	all:
+//	  max-tokens: 100000
+type FlagValues map[string]any
+
+// Config holds flag defaults and named profiles read from config files.
+type Config struct {
+	Defaults FlagValues            `yaml:"defaults"` // Applied to every run
+	Profiles map[string]FlagValues `yaml:"profiles"` // Applied on top of Defaults with --profile
+	Sources  []string              `yaml:"-"`        // Files the config was read from, lowest precedence first
+}
+
+// FindConfigFile returns the nearest ConfigFileName in dir or one of its
+// parents, or "" if there is none.
+func FindConfigFile(dir string) string {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return ""
+	}
+	for {
+		candidate := filepath.Join(absDir, ConfigFileName)
+		if info, err := os.Stat(candidate); err == nil && !info.IsDir() {
+			return candidate
+		}
+		parent := filepath.Dir(absDir)
+		if parent == absDir {
+			return ""
+		}
+		absDir = parent
+	}
+}
+
+// UserConfigFile returns the path of the per-user config file,
+// $XDG_CONFIG_HOME/como/config.yaml (~/.config/como/config.yaml by default).
+// The file may not exist.
+func UserConfigFile() string {
+	if xdg := os.Getenv("XDG_CONFIG_HOME"); xdg != "" {
+		return filepath.Join(xdg, "como", "config.yaml")
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		return filepath.Join(home, ".config", "como", "config.yaml")
+	}
+	return ""
+}
+
+// LoadConfig reads and merges config files, later files taking precedence.
+// Empty paths and missing files are skipped.
+func LoadConfig(paths ...string) (*Config, error) {
+	config := &Config{Defaults: FlagValues{}, Profiles: map[string]FlagValues{}}
+	for _, path := range paths {
+		if path == "" {
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read config file %s: %w", path, err)
+		}
+
+		var file Config
+		if err := yaml.Unmarshal(data, &file); err != nil {
+			return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+		}
+		mergeFlagValues(config.Defaults, file.Defaults)
+		for name, values := range file.Profiles {
+			if config.Profiles[name] == nil {
+				config.Profiles[name] = FlagValues{}
+			}
+			mergeFlagValues(config.Profiles[name], values)
+		}
+		config.Sources = append(config.Sources, path)
+	}
+	return config, nil
+}
+
+// mergeFlagValues copies src into dst, merging command sections key by key.
+func mergeFlagValues(dst, src FlagValues) {
+	for key, value := range src {
+		section, isSection := commandSection(value)
+		if !isSection {
+			dst[key] = value
+			continue
+		}
+		existing, ok := commandSection(dst[key])
+		if !ok {
+			existing = FlagValues{}
+			dst[key] = existing
+		}
+		for name, v := range section {
+			existing[name] = v
+		}
+	}
+}
+
+// commandSection returns value as a command section, if it is one. Nested
+// mappings decode as FlagValues, like the map holding them.
+func commandSection(value any) (FlagValues, bool) {
+	switch v := value.(type) {
+	case FlagValues:
+		return v, true
+	case map[string]any:
+		return v, true
+	default:
+		return nil, false
+	}
+}
+
+// FlagValuesFor returns the values configured for a command: the defaults,
+// then the command's section of the defaults, then the named profile and
+// its command section, each overriding the one before. An empty profile
+// selects only the defaults. Flags named in commandOnly are only taken from
+// the command's sections, for flags whose meaning differs between commands.
+func (c *Config) FlagValuesFor(command, profile string, commandOnly []string) (FlagValues, error) {
+	layers := []FlagValues{c.Defaults}
+	if profile != "" {
+		values, ok := c.Profiles[profile]
+		if !ok {
+			return nil, fmt.Errorf("unknown profile %q (available: %s)", profile, c.profileNames())
+		}
+		layers = append(layers, values)
+	}
+
+	result := FlagValues{}
+	for _, layer := range layers {
+		for key, value := range layer {
+			if _, isSection := commandSection(value); !isSection && !slices.Contains(commandOnly, key) {
+				result[key] = value
+			}
+		}
+		if section, ok := commandSection(layer[command]); ok {
+			for key, value := range section {
+				result[key] = value
+			}
+		}
+	}
+	return result, nil
+}
+
+func (c *Config) profileNames() string {
+	if len(c.Profiles) == 0 {
+		return "none"
+	}
+	names := make([]string, 0, len(c.Profiles))
+	for name := range c.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// ConfigValueStrings converts a configured value to the strings a flag is
+// set from. Lists yield one string per element; a nil value yields none.
+func ConfigValueStrings(value any) []string {
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case []any:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			values = append(values, fmt.Sprint(item))
+		}
+		return values
+	default:
+		return []string{fmt.Sprint(v)}
+	}
+}
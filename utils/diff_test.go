@@ -0,0 +1,77 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	oldText := "a\nb\nc\nd\ne\nf\ng\nh\ni\nj\nk\nl\n"
+	newText := "a\nB\nc\nd\ne\nf\ng\nh\ni\nj\nk\nl\nm"
+	want := "--- a/f\n+++ b/f\n" +
+		"@@ -1,5 +1,5 @@\n a\n-b\n+B\n c\n d\n e\n" +
+		"@@ -10,3 +10,4 @@\n j\n k\n l\n+m\n\\ No newline at end of file\n"
+	if got := UnifiedDiff("a/f", "b/f", oldText, newText); got != want {
+		t.Errorf("UnifiedDiff:\n%s\nwant:\n%s", got, want)
+	}
+	if got := UnifiedDiff("a/f", "b/f", oldText, oldText); got != "" {
+		t.Errorf("UnifiedDiff of equal texts = %q, want \"\"", got)
+	}
+}
+
+// applyDiffOps rebuilds both sides of an edit script.
+func applyDiffOps(ops []diffOp) (string, string) {
+	var a, b strings.Builder
+	for _, op := range ops {
+		if op.kind != '+' {
+			a.WriteString(op.line)
+		}
+		if op.kind != '-' {
+			b.WriteString(op.line)
+		}
+	}
+	return a.String(), b.String()
+}
+
+func TestDiffLines(t *testing.T) {
+	numbered := func(n int, format string) string {
+		var b strings.Builder
+		for i := range n {
+			fmt.Fprintf(&b, format, i)
+		}
+		return b.String()
+	}
+	tests := []struct {
+		name        string
+		a, b        string
+		wantChanges int // Number of '-' and '+' ops
+	}{
+		{"insert", "a\nc\n", "a\nb\nc\n", 1},
+		{"delete", "a\nb\nc\n", "a\nc\n", 1},
+		{"replace", "a\nb\nc\n", "a\nx\nc\n", 2},
+		{"from empty", "", "a\nb\n", 2},
+		{"to empty", "a\nb\n", "", 2},
+		{"interleaved", numbered(200, "line %d\n"), numbered(200, "line %d\n") + "end\n", 1},
+		// Past maxDiffEdits the differing middle is replaced as a block.
+		{"beyond the cap", "head\n" + numbered(3000, "old %d\n") + "tail\n", "head\n" + numbered(3000, "new %d\n") + "tail\n", 6000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ops := diffLines(splitLines(tt.a), splitLines(tt.b))
+			gotA, gotB := applyDiffOps(ops)
+			if gotA != tt.a || gotB != tt.b {
+				t.Fatalf("edit script does not rebuild the inputs")
+			}
+			changes := 0
+			for _, op := range ops {
+				if op.kind != ' ' {
+					changes++
+				}
+			}
+			if changes != tt.wantChanges {
+				t.Errorf("%d changed lines, want %d", changes, tt.wantChanges)
+			}
+		})
+	}
+}
@@ -0,0 +1,123 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/bmatcuk/doublestar/v4"
+)
+
+// fileArg is one argument of the 'files' command.
+type fileArg struct {
+	pattern string // Slash-separated doublestar pattern relative to the project root
+	negate  bool   // The argument started with "!"
+	literal bool   // The pattern has no glob metacharacters
+}
+
+// fileArgSelector decides which project files the arguments of the 'files'
+// command select. Arguments are doublestar patterns relative to the project
+// root, where "**" matches any number of directories. An argument matching
+// a directory selects everything below it, and "!pattern" takes matching
+// files back out. As in .gitignore, the last matching argument wins; if
+// every argument is negated, all files start out selected.
+type fileArgSelector struct {
+	args        []fileArg
+	onlyNegated bool
+}
+
+// newFileArgSelector parses args relative to absRootDir. Arguments naming
+// paths outside absRootDir cannot match project files and are returned
+// separately, unchanged.
+func newFileArgSelector(absRootDir string, args []string) (*fileArgSelector, []string, error) {
+	s := &fileArgSelector{onlyNegated: true}
+	var outside []string
+	for _, arg := range args {
+		negate := strings.HasPrefix(arg, "!")
+		pattern := strings.TrimPrefix(arg, "!")
+		if filepath.IsAbs(pattern) {
+			rel, err := filepath.Rel(absRootDir, pattern)
+			if err != nil {
+				rel = pattern
+			}
+			pattern = rel
+		}
+		pattern = path.Clean(filepath.ToSlash(pattern))
+		if pattern == ".." || strings.HasPrefix(pattern, "../") {
+			if !negate {
+				outside = append(outside, arg)
+			}
+			continue
+		}
+		if pattern == "." {
+			pattern = "**"
+		}
+		if !doublestar.ValidatePattern(pattern) {
+			return nil, nil, fmt.Errorf("invalid file pattern %s", arg)
+		}
+
+		s.args = append(s.args, fileArg{pattern: pattern, negate: negate, literal: !hasGlobMeta(pattern)})
+		if !negate {
+			s.onlyNegated = false
+		}
+	}
+	if len(s.args) == 0 {
+		s.onlyNegated = false
+	}
+	return s, outside, nil
+}
+
+// selects reports whether the file at slashPath is selected, and whether it
+// was named literally by the argument that selected it.
+func (s *fileArgSelector) selects(slashPath string) (selected, explicit bool) {
+	selected = s.onlyNegated
+	for _, arg := range s.args {
+		if !matchesPathOrParent(arg.pattern, slashPath) {
+			continue
+		}
+		selected = !arg.negate
+		explicit = selected && arg.literal && arg.pattern == slashPath
+	}
+	return selected, explicit
+}
+
+// literalFiles returns the paths (relative to absRootDir) of the non-negated
+// arguments if they all name existing regular files or symlinks, so the
+// project does not have to be listed to resolve them. Otherwise it returns
+// false.
+func (s *fileArgSelector) literalFiles(absRootDir string) ([]string, bool) {
+	if s.onlyNegated {
+		return nil, false
+	}
+	var paths []string
+	for _, arg := range s.args {
+		if arg.negate {
+			continue
+		}
+		if !arg.literal {
+			return nil, false
+		}
+		info, err := os.Lstat(filepath.Join(absRootDir, filepath.FromSlash(arg.pattern)))
+		if err != nil {
+			continue // Missing files select nothing
+		}
+		if info.IsDir() {
+			return nil, false
+		}
+		paths = append(paths, arg.pattern)
+	}
+	return paths, true
+}
+
+// matchesPathOrParent reports whether the doublestar pattern matches
+// slashPath or one of its parent directories.
+func matchesPathOrParent(pattern, slashPath string) bool {
+	for candidate := slashPath; candidate != "." && candidate != "/"; candidate = path.Dir(candidate) {
+		if ok, _ := doublestar.Match(pattern, candidate); ok {
+			return true
+		}
+	}
+	return false
+}
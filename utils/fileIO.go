@@ -4,8 +4,10 @@ import (
 	"bufio"
 	"bytes"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"unicode/utf8"
 )
 
 // ReadFileContent reads the content of a file into a string.
@@ -14,16 +16,179 @@ func ReadFileContent(filePath string) (string, bool, error) {
 	if err != nil {
 		return "", false, fmt.Errorf("failed to read file %s: %w", filePath, err)
 	}
+	text, isBinary := decodeContent(content)
+	return text, isBinary, nil
+}
+
+// ReadProjectFile reads a listed file: from its Git blob when it was listed
+// at a ref, otherwise from disk with ReadFileContent.
+func ReadProjectFile(fi FileInfo) (string, bool, error) {
+	if fi.Blob == nil {
+		return ReadFileContent(fi.AbsPath)
+	}
+	content, err := fi.Blob.Read()
+	if err != nil {
+		return "", false, err
+	}
+	text, isBinary := decodeContent(content)
+	return text, isBinary, nil
+}
+
+// ReadRenderFile loads a listed file for rendering. Text files on disk
+// larger than streamThreshold are not read into memory: only their first
+// block is sniffed for binary content, and the result carries a Stream
+// instead of Content. If maxFileSize is positive, content beyond that many
+// bytes is cut off and the file marked Truncated; a file on disk over the
+// limit is only read up to it.
+func ReadRenderFile(fi FileInfo, maxFileSize int64) (RenderFile, error) {
+	file := RenderFile{FileInfo: fi}
+
+	if fi.Blob == nil {
+		info, err := os.Stat(fi.AbsPath)
+		if err != nil {
+			return RenderFile{}, fmt.Errorf("failed to read file %s: %w", fi.AbsPath, err)
+		}
+		size := info.Size()
+		if maxFileSize > 0 && size > maxFileSize {
+			size = maxFileSize
+		}
+		switch {
+		case size > streamThreshold:
+			head, isBinary, err := sniffFile(fi.AbsPath)
+			if err != nil {
+				return RenderFile{}, err
+			}
+			file.IsBinary = isBinary
+			if isBinary {
+				return file, nil
+			}
+			if size < info.Size() {
+				file.Truncated, file.OriginalSize = true, info.Size()
+				if size, err = runeBoundary(fi.AbsPath, size); err != nil {
+					return RenderFile{}, err
+				}
+			}
+			file.Stream = &ContentStream{path: fi.AbsPath, Size: size}
+			file.Language = DetectLanguage(fi.RelPath, string(head))
+			return file, nil
+		case size < info.Size():
+			// Over a limit below streamThreshold: read one byte past it,
+			// so truncateContent can tell whether the cut splits a rune.
+			content, isBinary, err := readFileHead(fi.AbsPath, size+1)
+			if err != nil {
+				return RenderFile{}, err
+			}
+			file.IsBinary = isBinary
+			if isBinary {
+				return file, nil
+			}
+			file.Truncated, file.OriginalSize = true, info.Size()
+			file.Content = truncateContent(content, int(size))
+			file.Language = DetectLanguage(fi.RelPath, file.Content)
+			return file, nil
+		}
+	}
+
+	content, isBinary, err := ReadProjectFile(fi)
+	if err != nil {
+		return RenderFile{}, err
+	}
+	file.IsBinary = isBinary
+	if isBinary {
+		return file, nil
+	}
+	if maxFileSize > 0 && int64(len(content)) > maxFileSize {
+		file.Truncated, file.OriginalSize = true, int64(len(content))
+		content = truncateContent(content, int(maxFileSize))
+	}
+	file.Content = content
+	file.Language = DetectLanguage(fi.RelPath, content)
+	return file, nil
+}
+
+// readFileHead reads at most n bytes from the start of a file, like
+// ReadFileContent does for the whole file.
+func readFileHead(path string, n int64) (string, bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to read file %s: %w", path, err)
+	}
+	defer f.Close()
+	content, err := io.ReadAll(io.LimitReader(f, n))
+	if err != nil {
+		return "", false, fmt.Errorf("failed to read file %s: %w", path, err)
+	}
+	text, isBinary := decodeContent(content)
+	return text, isBinary, nil
+}
+
+// sniffLen is how much of a file is checked for NUL bytes to detect binary
+// content.
+const sniffLen = 1024
+
+// sniffFile reads the first sniffLen bytes of a file and reports whether
+// they look binary (see decodeContent).
+func sniffFile(path string) ([]byte, bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read file %s: %w", path, err)
+	}
+	defer f.Close()
+	head := make([]byte, sniffLen)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, false, fmt.Errorf("failed to read file %s: %w", path, err)
+	}
+	head = head[:n]
+	return head, bytes.IndexByte(head, 0) >= 0, nil
+}
+
+// runeBoundary moves a cut at offset size back so it does not split a UTF-8
+// sequence, like truncateContent does for content in memory.
+func runeBoundary(path string, size int64) (int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read file %s: %w", path, err)
+	}
+	defer f.Close()
+	start := max(size-utf8.UTFMax+1, 0)
+	buf := make([]byte, size-start+1)
+	n, err := f.ReadAt(buf, start)
+	if err != nil && err != io.EOF {
+		return 0, fmt.Errorf("failed to read file %s: %w", path, err)
+	}
+	cut := min(int(size-start), n)
+	for cut > 0 && cut < n && !utf8.RuneStart(buf[cut]) {
+		cut--
+	}
+	return start + int64(cut), nil
+}
+
+// truncateContent cuts content to at most maxBytes, without splitting a
+// UTF-8 sequence.
+func truncateContent(content string, maxBytes int) string {
+	if len(content) <= maxBytes {
+		return content
+	}
+	cut := maxBytes
+	for cut > 0 && !utf8.RuneStart(content[cut]) {
+		cut--
+	}
+	return content[:cut]
+}
 
-	checkLen := 1024
+// decodeContent returns content as a string, or reports it as binary if a
+// NUL byte appears in its first sniffLen bytes.
+func decodeContent(content []byte) (string, bool) {
+	checkLen := sniffLen
 	if len(content) < checkLen {
 		checkLen = len(content)
 	}
 	if bytes.Contains(content[:checkLen], []byte{0}) {
-		return "", true, nil
+		return "", true
 	}
 
-	return string(content), false, nil
+	return string(content), false
 }
 
 // GetOutputWriter returns a writer to the specified output file or os.Stdout.
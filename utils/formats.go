@@ -0,0 +1,49 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Output formats supported by the 'all' and 'files' commands.
+const (
+	FormatText     = "text"
+	FormatMarkdown = "markdown"
+	FormatXML      = "xml"
+	FormatJSON     = "json"
+	FormatJSONL    = "jsonl"
+)
+
+// ParseFormat normalizes a --format value and rejects unknown formats.
+func ParseFormat(format string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(format)) {
+	case "", "text", "txt":
+		return FormatText, nil
+	case "markdown", "md":
+		return FormatMarkdown, nil
+	case "xml":
+		return FormatXML, nil
+	case "json":
+		return FormatJSON, nil
+	case "jsonl", "ndjson":
+		return FormatJSONL, nil
+	default:
+		return "", fmt.Errorf("unknown output format %q (supported: text, markdown, xml, json, jsonl)", format)
+	}
+}
+
+// FormatExtension returns the file extension conventionally used for a format.
+func FormatExtension(format string) string {
+	switch format {
+	case FormatMarkdown:
+		return ".md"
+	case FormatXML:
+		return ".xml"
+	case FormatJSON:
+		return ".json"
+	case FormatJSONL:
+		return ".jsonl"
+	default:
+		return ".txt"
+	}
+}
@@ -0,0 +1,386 @@
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/gobwas/glob"
+)
+
+// Labels of the pseudo-files a diff bundle adds next to the changed files.
+// ParseBundle ignores them so a diff bundle can be unpacked.
+const (
+	DiffSectionName = "GIT DIFF"
+	OriginalSuffix  = " (original)"
+)
+
+// Special values of DiffSpec.NewRev.
+const (
+	WorkingTreeRev = ""  // New versions are read from the working tree
+	IndexRev       = ":" // New versions are read from the index
+)
+
+// Git status letters of a changed file.
+const (
+	StatusAdded    = "A"
+	StatusDeleted  = "D"
+	StatusModified = "M"
+)
+
+// DiffSpec selects the two sides of a diff bundle.
+type DiffSpec struct {
+	OldRev      string // Commit the changes are measured from
+	NewRev      string // Commit with the new versions, or WorkingTreeRev / IndexRev
+	Description string // Human-readable summary, e.g. "main...working tree"
+}
+
+// ChangedFile is a file touched between the two sides of a DiffSpec.
+type ChangedFile struct {
+	FileInfo
+	Status    string // StatusAdded, StatusDeleted, StatusModified or another git status letter
+	Untracked bool   // New file Git does not track yet, listed when comparing with the working tree
+}
+
+// ResolveDiffSpec builds the DiffSpec for `como diff`. At most one of since,
+// staged and rangeSpec may be set; with none, uncommitted changes (HEAD to
+// working tree) are used.
+//
+//   - since: changes on the working tree since it forked from this ref
+//   - staged: staged changes (HEAD to index)
+//   - rangeSpec: "a..b" (a to b) or "a...b" (merge base of a and b to b)
+func ResolveDiffSpec(dir, since string, staged bool, rangeSpec string) (DiffSpec, error) {
+	if !isGitRepo(dir) {
+		return DiffSpec{}, fmt.Errorf("%s is not inside a Git repository", dir)
+	}
+
+	switch {
+	case since != "":
+		base, err := mergeBase(dir, since, "HEAD")
+		if err != nil {
+			return DiffSpec{}, err
+		}
+		return DiffSpec{OldRev: base, NewRev: WorkingTreeRev, Description: since + "...working tree"}, nil
+
+	case staged:
+		return DiffSpec{OldRev: "HEAD", NewRev: IndexRev, Description: "HEAD..index"}, nil
+
+	case rangeSpec != "":
+		if from, to, ok := strings.Cut(rangeSpec, "..."); ok {
+			from, to = defaultRev(from), defaultRev(to)
+			base, err := mergeBase(dir, from, to)
+			if err != nil {
+				return DiffSpec{}, err
+			}
+			if err := verifyRev(dir, to); err != nil {
+				return DiffSpec{}, err
+			}
+			return DiffSpec{OldRev: base, NewRev: to, Description: from + "..." + to}, nil
+		}
+		from, to, ok := strings.Cut(rangeSpec, "..")
+		if !ok {
+			return DiffSpec{}, fmt.Errorf("invalid range %q (expected a..b or a...b)", rangeSpec)
+		}
+		from, to = defaultRev(from), defaultRev(to)
+		for _, rev := range []string{from, to} {
+			if err := verifyRev(dir, rev); err != nil {
+				return DiffSpec{}, err
+			}
+		}
+		return DiffSpec{OldRev: from, NewRev: to, Description: from + ".." + to}, nil
+
+	default:
+		return DiffSpec{OldRev: "HEAD", NewRev: WorkingTreeRev, Description: "HEAD..working tree"}, nil
+	}
+}
+
+// defaultRev returns HEAD for an omitted side of a range.
+func defaultRev(rev string) string {
+	if rev == "" {
+		return "HEAD"
+	}
+	return rev
+}
+
+func verifyRev(dir, rev string) error {
+	if _, err := runGit(dir, "rev-parse", "--verify", "--quiet", rev+"^{commit}"); err != nil {
+		return fmt.Errorf("unknown revision %q", rev)
+	}
+	return nil
+}
+
+func mergeBase(dir, a, b string) (string, error) {
+	for _, rev := range []string{a, b} {
+		if err := verifyRev(dir, rev); err != nil {
+			return "", err
+		}
+	}
+	base, err := runGit(dir, "merge-base", a, b)
+	if err != nil || base == "" {
+		return "", fmt.Errorf("no common ancestor of %s and %s", a, b)
+	}
+	return base, nil
+}
+
+// diffArgs returns the git diff arguments comparing the two sides of spec,
+// limited to and relative to the directory git runs in.
+func (spec DiffSpec) diffArgs(extra ...string) []string {
+	args := append([]string{"diff", "--relative", "--no-renames", "--no-color"}, extra...)
+	switch spec.NewRev {
+	case WorkingTreeRev:
+		args = append(args, spec.OldRev)
+	case IndexRev:
+		args = append(args, "--cached", spec.OldRev)
+	default:
+		args = append(args, spec.OldRev, spec.NewRev)
+	}
+	return append(args, "--")
+}
+
+// ChangedFiles lists the files under dir that differ between the two sides
+// of spec, in path order, leaving out files matching customIgnorePatterns
+// and, unless allowSensitive is set, sensitive files (see isSensitiveFile).
+// Against the working tree, untracked files that are not ignored are listed
+// as added.
+func ChangedFiles(dir string, spec DiffSpec, customIgnorePatterns []string, allowSensitive bool) ([]ChangedFile, error) {
+	customMatchers := make([]glob.Glob, 0, len(customIgnorePatterns))
+	for _, pattern := range customIgnorePatterns {
+		g, err := glob.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid custom ignore pattern %s: %w", pattern, err)
+		}
+		customMatchers = append(customMatchers, g)
+	}
+
+	out, err := gitOutput(dir, spec.diffArgs("--name-status", "-z")...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list changed files: %w", err)
+	}
+
+	// Output is "status NUL path NUL" pairs
+	var candidates []ChangedFile
+	fields := strings.Split(strings.TrimRight(string(out), "\x00"), "\x00")
+	for i := 0; i+1 < len(fields); i += 2 {
+		candidates = append(candidates, ChangedFile{FileInfo: FileInfo{RelPath: fields[i+1]}, Status: fields[i][:1]})
+	}
+	if spec.NewRev == WorkingTreeRev {
+		out, err := gitOutput(dir, "ls-files", "--others", "--exclude-standard", "-z", "--")
+		if err != nil {
+			return nil, fmt.Errorf("failed to list untracked files: %w", err)
+		}
+		for _, slashPath := range strings.Split(strings.TrimRight(string(out), "\x00"), "\x00") {
+			if slashPath != "" {
+				candidates = append(candidates, ChangedFile{FileInfo: FileInfo{RelPath: slashPath}, Status: StatusAdded, Untracked: true})
+			}
+		}
+		sort.Slice(candidates, func(i, j int) bool {
+			return candidates[i].RelPath < candidates[j].RelPath
+		})
+	}
+
+	var changed []ChangedFile
+	var withheld []string
+	for _, c := range candidates {
+		slashPath := c.RelPath
+		if matchesAny(customMatchers, slashPath) {
+			continue
+		}
+		relPath := filepath.FromSlash(slashPath)
+		if !allowSensitive && isSensitiveFile(slashPath) {
+			withheld = append(withheld, relPath)
+			continue
+		}
+		c.FileInfo = FileInfo{AbsPath: filepath.Join(dir, relPath), RelPath: relPath}
+		changed = append(changed, c)
+	}
+	reportWithheld(withheld)
+	return changed, nil
+}
+
+// GitDiffText returns the unified diff of the given files between the two
+// sides of spec. Untracked files are diffed against /dev/null after the
+// tracked ones.
+func GitDiffText(dir string, spec DiffSpec, files []ChangedFile) (string, error) {
+	args := spec.diffArgs()
+	var tracked, untracked []string
+	for _, f := range files {
+		if f.Untracked {
+			untracked = append(untracked, filepath.ToSlash(f.RelPath))
+		} else {
+			tracked = append(tracked, filepath.ToSlash(f.RelPath))
+		}
+	}
+
+	var b strings.Builder
+	if len(tracked) > 0 {
+		out, err := gitOutput(dir, append(args, tracked...)...)
+		if err != nil {
+			return "", fmt.Errorf("failed to compute diff: %w", err)
+		}
+		b.Write(out)
+	}
+	for _, slashPath := range untracked {
+		// Exits with 1 when the files differ, which they always do
+		out, err := gitOutputCodes(dir, []int{1}, "diff", "--no-color", "--no-index", "--", "/dev/null", slashPath)
+		if err != nil {
+			return "", fmt.Errorf("failed to compute diff of %s: %w", slashPath, err)
+		}
+		b.Write(out)
+	}
+	return b.String(), nil
+}
+
+// ReadRevisionFile reads relPath (relative to dir) as of rev, which may be
+// IndexRev for the staged version. Binary content is reported, not returned.
+func ReadRevisionFile(dir, rev, relPath string) (string, bool, error) {
+	object := rev + ":./" + filepath.ToSlash(relPath)
+	if rev == IndexRev {
+		object = ":./" + filepath.ToSlash(relPath)
+	}
+	out, err := gitOutput(dir, "show", object)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to read %s: %w", object, err)
+	}
+	content, isBinary := decodeContent(out)
+	return content, isBinary, nil
+}
+
+// gitOutput runs a git subcommand in dir and returns its raw stdout. Unlike
+// runGit it keeps whitespace and includes stderr in the error.
+func gitOutput(dir string, args ...string) ([]byte, error) {
+	return gitOutputCodes(dir, nil, args...)
+}
+
+// gitOutputCodes is gitOutput for a subcommand that may also succeed with
+// one of the exit codes in okCodes.
+func gitOutputCodes(dir string, okCodes []int, args ...string) ([]byte, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && slices.Contains(okCodes, exitErr.ExitCode()) {
+			return stdout.Bytes(), nil
+		}
+		return nil, fmt.Errorf("git %s: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.Bytes(), nil
+}
+
+// DiffRenderOptions controls RenderDiff.
+type DiffRenderOptions struct {
+	SkipBinary      bool           // Skip binary files instead of rendering them empty
+	IncludeOriginal bool           // Also render the old version of modified and deleted files
+	Secrets         *SecretScanner // Scans the diff and the files for secrets, if set
+}
+
+// diffEntry is a file of a diff bundle, loaded before anything is written.
+type diffEntry struct {
+	file       RenderFile
+	skipReason string // Non-empty if the file is to be reported via SkipFile
+}
+
+// RenderDiff drives r over a diff bundle: the unified diff of files as a
+// DiffSectionName pseudo-file, then the new version of every changed file
+// (and, if requested, its old version labelled with OriginalSuffix).
+// Deleted files are reported via SkipFile. Everything is loaded first, so
+// with --secrets fail nothing is written if a secret is found.
+func RenderDiff(r Renderer, doc DocumentInfo, dir string, spec DiffSpec, files []ChangedFile, opts DiffRenderOptions) error {
+	diffText, err := GitDiffText(dir, spec, files)
+	if err != nil {
+		return err
+	}
+	load := loadOptions{SkipBinary: opts.SkipBinary, Secrets: opts.Secrets}
+
+	diffFile := RenderFile{
+		FileInfo: FileInfo{RelPath: DiffSectionName + " (" + spec.Description + ")"},
+		Content:  diffText,
+		Language: "diff",
+	}
+	reason, err := opts.Secrets.apply(&diffFile)
+	if err != nil {
+		return err
+	}
+	entries := []diffEntry{{file: diffFile, skipReason: reason}}
+
+	for _, changed := range files {
+		if changed.Status == StatusDeleted {
+			entries = append(entries, diffEntry{file: RenderFile{FileInfo: changed.FileInfo}, skipReason: "deleted"})
+		} else {
+			file, skipReason := loadRevisionFile(dir, spec.NewRev, changed.FileInfo, load)
+			if skipReason != "" {
+				file.FileInfo = changed.FileInfo
+			}
+			entries = append(entries, diffEntry{file: file, skipReason: skipReason})
+		}
+
+		if !opts.IncludeOriginal || changed.Status == StatusAdded {
+			continue
+		}
+		original, skipReason := loadRevisionFile(dir, spec.OldRev, changed.FileInfo, load)
+		if skipReason != "" {
+			continue
+		}
+		original.RelPath += OriginalSuffix
+		entries = append(entries, diffEntry{file: original})
+	}
+
+	if opts.Secrets.active() && opts.Secrets.Mode == SecretsFail {
+		if err := opts.Secrets.foundError(); err != nil {
+			return err
+		}
+	}
+
+	if err := r.BeginDocument(doc); err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if entry.skipReason != "" {
+			err = r.SkipFile(entry.file.FileInfo, entry.skipReason)
+		} else {
+			err = r.WriteFile(entry.file)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return r.EndDocument()
+}
+
+// loadRevisionFile is loadRenderFile for a file as of rev.
+func loadRevisionFile(dir, rev string, fileInfo FileInfo, opts loadOptions) (RenderFile, string) {
+	if rev == WorkingTreeRev {
+		return loadRenderFile(fileInfo, opts)
+	}
+
+	content, isBinary, err := ReadRevisionFile(dir, rev, fileInfo.RelPath)
+	if err != nil {
+		Log.Warnf("skipping file %s due to read error: %v", fileInfo.RelPath, err)
+		return RenderFile{}, SkipReasonReadError
+	}
+	if isBinary && opts.SkipBinary {
+		Log.Verbosef("  Skipping binary file: %s", fileInfo.RelPath)
+		return RenderFile{}, SkipReasonBinary
+	}
+
+	file := RenderFile{FileInfo: fileInfo, Content: content, IsBinary: isBinary}
+	if !isBinary {
+		file.Language = DetectLanguage(fileInfo.RelPath, content)
+	}
+	reason, err := opts.Secrets.apply(&file)
+	if err != nil {
+		return RenderFile{}, SkipReasonReadError
+	}
+	if reason != "" {
+		Log.Verbosef("  Skipping file with secrets: %s", fileInfo.RelPath)
+		return RenderFile{}, reason
+	}
+	return file, ""
+}
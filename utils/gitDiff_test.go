@@ -0,0 +1,74 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestChangedFilesIncludesUntracked(t *testing.T) {
+	requireGit(t)
+	root, _ := writeTestProject(t, map[string]string{
+		".gitignore": "*.log\n",
+		"kept.go":    "package a\n",
+		"edited.go":  "package a\n",
+	})
+	testGit(t, root, "init", "-q")
+	testGit(t, root, "add", "-A")
+	testGit(t, root, "commit", "-q", "-m", "initial")
+
+	for name, content := range map[string]string{
+		"edited.go":        "package a // edited\n",
+		"untracked.go":     "package a\n\nfunc New() {}\n",
+		"sub/untracked.go": "package sub\n",
+		"ignored.log":      "ignored\n",
+	} {
+		full := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(full, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	spec, err := ResolveDiffSpec(root, "", false, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	changed, err := ChangedFiles(root, spec, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, f := range changed {
+		got = append(got, f.Status+" "+filepath.ToSlash(f.RelPath))
+	}
+	if want := "M edited.go, A sub/untracked.go, A untracked.go"; strings.Join(got, ", ") != want {
+		t.Errorf("changed files: %s, want %s", strings.Join(got, ", "), want)
+	}
+
+	diff, err := GitDiffText(root, spec, changed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"+++ b/edited.go",
+		"--- /dev/null\n+++ b/untracked.go\n@@ -0,0 +1,3 @@\n+package a\n+\n+func New() {}\n",
+		"--- /dev/null\n+++ b/sub/untracked.go\n",
+	} {
+		if !strings.Contains(diff, want) {
+			t.Errorf("diff lacks %q:\n%s", want, diff)
+		}
+	}
+
+	// Staged changes leave untracked files out
+	staged, err := ChangedFiles(root, DiffSpec{OldRev: "HEAD", NewRev: IndexRev}, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(staged) != 0 {
+		t.Errorf("staged changes: %+v, want none", staged)
+	}
+}
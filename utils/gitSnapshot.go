@@ -0,0 +1,253 @@
+package utils
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/fs"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gobwas/glob"
+)
+
+// GitBlob is the content of a file as stored in a Git commit.
+type GitBlob struct {
+	ID     string           // Object ID of the blob
+	reader *GitObjectReader // Reader the blob is fetched with
+}
+
+// Read returns the blob's content.
+func (b *GitBlob) Read() ([]byte, error) {
+	return b.reader.Read(b.ID)
+}
+
+// GitObjectReader fetches objects through one long-running
+// `git cat-file --batch` process. It is safe for concurrent use.
+type GitObjectReader struct {
+	mu     sync.Mutex
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout *bufio.Reader
+}
+
+// NewGitObjectReader starts a `git cat-file --batch` process in dir. Close
+// must be called when done.
+func NewGitObjectReader(dir string) (*GitObjectReader, error) {
+	cmd := exec.Command("git", "cat-file", "--batch")
+	cmd.Dir = dir
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open git cat-file input: %w", err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open git cat-file output: %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start git cat-file: %w", err)
+	}
+	return &GitObjectReader{cmd: cmd, stdin: stdin, stdout: bufio.NewReader(stdout)}, nil
+}
+
+// Read returns the content of the object with the given ID.
+func (r *GitObjectReader) Read(id string) ([]byte, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, err := io.WriteString(r.stdin, id+"\n"); err != nil {
+		return nil, fmt.Errorf("failed to request object %s: %w", id, err)
+	}
+	// Header is "<id> <type> <size>", or "<id> missing"
+	header, err := r.stdout.ReadString('\n')
+	if err != nil {
+		return nil, fmt.Errorf("failed to read object %s: %w", id, err)
+	}
+	fields := strings.Fields(header)
+	if len(fields) != 3 {
+		return nil, fmt.Errorf("failed to read object %s: %s", id, strings.TrimSpace(header))
+	}
+	size, err := strconv.ParseInt(fields[2], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read object %s: bad size %q", id, fields[2])
+	}
+
+	content := make([]byte, size+1) // Content is followed by a newline
+	if _, err := io.ReadFull(r.stdout, content); err != nil {
+		return nil, fmt.Errorf("failed to read object %s: %w", id, err)
+	}
+	return content[:size], nil
+}
+
+// Close stops the git process.
+func (r *GitObjectReader) Close() error {
+	r.stdin.Close()
+	return r.cmd.Wait()
+}
+
+// GetProjectFilesAtRef is GetProjectFiles for the project as of a Git ref
+// (commit, tag or branch), without checking it out. Files are listed with
+// `git ls-tree` and carry a Blob to read their content from; the returned
+// reader serves those reads and must be closed when done.
+//
+// Everything in the commit is tracked, so .gitignore is not consulted. The
+// .comoignore and .comoinclude files are read from the ref and applied as in
+// GetProjectFiles. includePatterns and specificFileArgs are matched against
+// the listed paths, and sensitive files are withheld unless allowSensitive
+// is set.
+func GetProjectFilesAtRef(
+	rootDir, ref string, customIgnorePatterns []string, includePatterns []string,
+	specificFileArgs []string, includeDirsInResult bool, allowSensitive bool) ([]FileInfo, *GitObjectReader, error) {
+
+	absRootDir, err := filepath.Abs(rootDir)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get absolute path for rootDir %s: %w", rootDir, err)
+	}
+	if !isGitRepo(absRootDir) {
+		return nil, nil, fmt.Errorf("%s is not inside a Git repository", absRootDir)
+	}
+	if err := verifyRev(absRootDir, ref); err != nil {
+		return nil, nil, err
+	}
+
+	customMatchers := make([]glob.Glob, 0, len(customIgnorePatterns))
+	for _, pattern := range customIgnorePatterns {
+		g, err := glob.Compile(pattern)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid custom ignore pattern %s: %w", pattern, err)
+		}
+		customMatchers = append(customMatchers, g)
+	}
+	if err := validateIncludePatterns(includePatterns); err != nil {
+		return nil, nil, err
+	}
+
+	// File arguments are matched relative to the project root; paths
+	// outside it cannot be in the listing
+	selector, _, err := newFileArgSelector(absRootDir, specificFileArgs)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Paths are relative to rootDir
+	Log.Debugf("listing files of %s in %s with 'git ls-tree'", ref, absRootDir)
+	out, err := gitOutput(absRootDir, "ls-tree", "-r", "-t", "-z", ref, "--", ".")
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to list files at %s: %w", ref, err)
+	}
+
+	reader, err := NewGitObjectReader(absRootDir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Lines are "<mode> SP <type> SP <id> TAB <path>"
+	type treeEntry struct{ mode, objectType, id, slashPath string }
+	var entries []treeEntry
+	comoBlobs := make(map[string]string) // Blob IDs of .comoignore and .comoinclude files by absolute path
+	for _, entry := range strings.Split(strings.TrimRight(string(out), "\x00"), "\x00") {
+		meta, slashPath, ok := strings.Cut(entry, "\t")
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(meta)
+		if len(fields) != 3 || fields[1] == "commit" { // Submodules have no content here
+			continue
+		}
+		entries = append(entries, treeEntry{fields[0], fields[1], fields[2], slashPath})
+		if name := path.Base(slashPath); fields[1] == "blob" && (name == ComoIgnoreFile || slashPath == ComoIncludeFile) {
+			comoBlobs[filepath.Join(absRootDir, filepath.FromSlash(slashPath))] = fields[2]
+		}
+	}
+
+	// The project-local rules as recorded in the ref
+	readBlob := func(name string) ([]byte, error) {
+		id, ok := comoBlobs[name]
+		if !ok {
+			return nil, fs.ErrNotExist
+		}
+		return reader.Read(id)
+	}
+	comoIgnoreMatcher := newComoIgnoreMatcher(readBlob, absRootDir)
+	comoIncludeMatcher := newComoIncludeMatcher(readBlob, absRootDir)
+
+	var result []FileInfo
+	var withheld []string
+	for _, entry := range entries {
+		slashPath := entry.slashPath
+		relPath := filepath.FromSlash(slashPath)
+		isDir := entry.objectType == "tree"
+
+		if comoIgnoreMatcher.Ignored(relPath, isDir) {
+			continue
+		}
+		// Directories are kept below if they hold an allowed file
+		if comoIncludeMatcher != nil && !isDir && !comoIncludeMatcher.Listed(relPath, false) {
+			continue
+		}
+		if matchesAny(customMatchers, slashPath) {
+			continue
+		}
+		selected, explicit := selector.selects(slashPath)
+		if len(specificFileArgs) > 0 && !selected {
+			continue
+		}
+		if len(includePatterns) > 0 && !isDir && !matchesIncludePatterns(includePatterns, slashPath) {
+			continue
+		}
+
+		if !allowSensitive && !isDir && isSensitiveFile(slashPath) {
+			withheld = append(withheld, relPath)
+			continue
+		}
+		fi := FileInfo{
+			AbsPath:   filepath.Join(absRootDir, relPath),
+			RelPath:   relPath,
+			IsDir:     isDir,
+			IsSymlink: entry.mode == "120000",
+			Explicit:  explicit || !isDir && namedByIncludePattern(includePatterns, slashPath),
+		}
+		if fi.IsDir && !includeDirsInResult {
+			continue
+		}
+		if !fi.IsDir {
+			fi.Blob = &GitBlob{ID: entry.id, reader: reader}
+		}
+		result = append(result, fi)
+	}
+
+	if (comoIncludeMatcher != nil || len(includePatterns) > 0) && includeDirsInResult {
+		result = pruneEmptyDirs(result)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].RelPath < result[j].RelPath
+	})
+	reportWithheld(withheld)
+	return result, reader, nil
+}
+
+// GetGitRefInfo is GetGitInfo for a ref rather than the checked-out HEAD.
+// Branch is set only when ref names a branch.
+func GetGitRefInfo(dir, ref string) GitInfo {
+	if !isGitRepo(dir) {
+		return GitInfo{}
+	}
+
+	info := GitInfo{IsRepo: true}
+	if out, err := runGit(dir, "rev-parse", ref+"^{commit}"); err == nil {
+		info.Commit = out
+	}
+	if out, err := runGit(dir, "rev-parse", "--short", ref+"^{commit}"); err == nil {
+		info.ShortCommit = out
+	}
+	if _, err := runGit(dir, "show-ref", "--verify", "--quiet", "refs/heads/"+ref); err == nil {
+		info.Branch = ref
+	}
+	return info
+}
@@ -0,0 +1,70 @@
+package utils
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestGetProjectFilesAtRefAppliesComoRules(t *testing.T) {
+	requireGit(t)
+	root, _ := writeTestProject(t, map[string]string{
+		".comoignore":     "drop.go\n",
+		".comoinclude":    "*.go\nsub/\n",
+		"drop.go":         "package a\n",
+		"keep.go":         "package a\n",
+		"notes.md":        "not listed\n",
+		"sub/.comoignore": "*.tmp\n",
+		"sub/a.txt":       "a\n",
+		"sub/b.tmp":       "b\n",
+	})
+	testGit(t, root, "init", "-q")
+	testGit(t, root, "add", "-A")
+	testGit(t, root, "commit", "-q", "-m", "initial")
+
+	// The rules come from the ref, not from the working tree
+	if err := os.Remove(filepath.Join(root, ".comoignore")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(root, ".comoinclude")); err != nil {
+		t.Fatal(err)
+	}
+
+	files, reader, err := GetProjectFilesAtRef(root, "HEAD", nil, nil, nil, true, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	var got []string
+	for _, f := range files {
+		got = append(got, filepath.ToSlash(f.RelPath))
+	}
+	want := []string{"keep.go", "sub", "sub/.comoignore", "sub/a.txt"}
+	if !slices.Equal(got, want) {
+		t.Errorf("listed %v, want %v", got, want)
+	}
+}
+
+// requireGit skips the test if git is not installed.
+func requireGit(t *testing.T) {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+}
+
+// testGit runs git in dir with the user's and the system's config kept out.
+func testGit(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GIT_CONFIG_NOSYSTEM=1", "GIT_CONFIG_GLOBAL="+os.DevNull,
+		"GIT_AUTHOR_NAME=t", "GIT_AUTHOR_EMAIL=t@example.com", "GIT_COMMITTER_NAME=t", "GIT_COMMITTER_EMAIL=t@example.com")
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %v: %v\n%s", args, err, out)
+	}
+	return string(out)
+}
@@ -1,10 +1,13 @@
 package utils
 
 import (
+	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 )
 
 // isGitRepo checks if the given directory is part of a Git repository.
@@ -20,3 +23,114 @@ func isGitRepo(dir string) bool {
 	output, err := cmd.Output()
 	return err == nil && strings.TrimSpace(string(output)) == "true"
 }
+
+// GitInfo describes the state of the Git repository containing a project.
+type GitInfo struct {
+	IsRepo      bool   // True if the project is inside a Git work tree
+	Branch      string // Current branch name, empty when HEAD is detached
+	Commit      string // Full hash of HEAD
+	ShortCommit string // Abbreviated hash of HEAD
+	Dirty       bool   // True if the work tree has uncommitted changes
+}
+
+// GetGitInfo collects branch and commit information for dir. Fields that
+// cannot be determined (e.g. in a repository without commits) are left empty.
+func GetGitInfo(dir string) GitInfo {
+	if !isGitRepo(dir) {
+		return GitInfo{}
+	}
+
+	info := GitInfo{IsRepo: true}
+	if out, err := runGit(dir, "rev-parse", "HEAD"); err == nil {
+		info.Commit = out
+	}
+	if out, err := runGit(dir, "rev-parse", "--short", "HEAD"); err == nil {
+		info.ShortCommit = out
+	}
+	if out, err := runGit(dir, "symbolic-ref", "--short", "-q", "HEAD"); err == nil {
+		info.Branch = out
+	}
+	if out, err := runGit(dir, "status", "--porcelain"); err == nil {
+		info.Dirty = out != ""
+	}
+	return info
+}
+
+// runGit runs a git subcommand in dir and returns its trimmed stdout.
+func runGit(dir string, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	output, err := cmd.Output()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// GitStashSnapshot records the uncommitted changes to tracked files in dir
+// as a stash entry with the given message, leaving the working tree as it
+// is. It returns the stash commit, or "" if there was nothing to record.
+func GitStashSnapshot(dir, message string) (string, error) {
+	if !isGitRepo(dir) {
+		return "", fmt.Errorf("%s is not inside a Git repository", dir)
+	}
+	commit, err := runGit(dir, "stash", "create", message)
+	if err != nil {
+		return "", fmt.Errorf("failed to create stash: %w", err)
+	}
+	if commit == "" {
+		return "", nil
+	}
+	if _, err := runGit(dir, "stash", "store", "-m", message, commit); err != nil {
+		return "", fmt.Errorf("failed to store stash %s: %w", commit, err)
+	}
+	return commit, nil
+}
+
+// RecentlyChangedFiles returns the last change time (Unix seconds) of files
+// under dir, keyed by slash-separated path relative to dir. It looks at the
+// last maxCommits commits, and uncommitted changes count as changed now.
+// Outside a Git repository it returns an empty map.
+func RecentlyChangedFiles(dir string, maxCommits int) map[string]int64 {
+	changed := make(map[string]int64)
+	if !isGitRepo(dir) {
+		return changed
+	}
+
+	out, err := runGit(dir, "log", "--relative", "--name-only", "--format=%x00%ct", "-n", strconv.Itoa(maxCommits))
+	if err != nil {
+		Log.Debugf("could not read git log in %s: %v", dir, err)
+	}
+	var commitTime int64
+	for _, line := range strings.Split(out, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "\x00") {
+			commitTime, _ = strconv.ParseInt(line[1:], 10, 64)
+			continue
+		}
+		// git log lists newer commits first, so keep the first time seen.
+		if _, seen := changed[line]; !seen {
+			changed[line] = commitTime
+		}
+	}
+
+	now := time.Now().Unix()
+	for _, args := range [][]string{
+		{"diff", "--name-only", "--relative", "HEAD"},
+		{"ls-files", "--others", "--exclude-standard"},
+	} {
+		out, err := runGit(dir, args...)
+		if err != nil {
+			continue
+		}
+		for _, line := range strings.Split(out, "\n") {
+			if line = strings.TrimSpace(line); line != "" {
+				changed[line] = now
+			}
+		}
+	}
+	return changed
+}
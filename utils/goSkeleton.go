@@ -0,0 +1,57 @@
+package utils
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"strings"
+)
+
+// elidedBody replaces function bodies in Go skeletons.
+const elidedBody = "{ ... }"
+
+// goSkeleton cuts Go source down to its package clause, imports and
+// declarations: the bodies of functions, methods and function literals are
+// replaced with "{ ... }". Everything else, doc comments included, is kept
+// as written. Empty bodies are kept, since they say the function does
+// nothing.
+func goSkeleton(content string) (string, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", content, parser.ParseComments|parser.SkipObjectResolution)
+	if err != nil {
+		return "", err
+	}
+
+	// Inspect visits nodes in source order and bodies are not descended
+	// into, so the bodies found do not overlap and are sorted.
+	var bodies []*ast.BlockStmt
+	ast.Inspect(file, func(n ast.Node) bool {
+		var body *ast.BlockStmt
+		switch n := n.(type) {
+		case *ast.FuncDecl:
+			body = n.Body
+		case *ast.FuncLit:
+			body = n.Body
+		default:
+			return true
+		}
+		if body != nil && len(body.List) > 0 {
+			bodies = append(bodies, body)
+			return false
+		}
+		return true
+	})
+
+	var b strings.Builder
+	b.Grow(len(content))
+	last := 0
+	for _, body := range bodies {
+		start := fset.Position(body.Lbrace).Offset
+		end := fset.Position(body.Rbrace).Offset + 1
+		b.WriteString(content[last:start])
+		b.WriteString(elidedBody)
+		last = end
+	}
+	b.WriteString(content[last:])
+	return b.String(), nil
+}
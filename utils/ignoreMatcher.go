@@ -0,0 +1,384 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// ignoreRule is one compiled line of a gitignore-style file.
+type ignoreRule struct {
+	re      *regexp.Regexp // Matches paths relative to base
+	base    string         // Slash-separated directory the rule is relative to ("" for the root)
+	negate  bool           // "!pattern": re-include what an earlier rule excluded
+	dirOnly bool           // "pattern/": only match directories
+}
+
+// IgnoreMatcher applies gitignore semantics to paths below a root
+// directory: per-directory ignore files (e.g. .gitignore) in the root and
+// every subdirectory, plus global pattern files with lower precedence.
+// Within the rules that apply to a path the last match wins, rules from
+// deeper directories override shallower ones, and nothing inside an
+// ignored directory can be re-included.
+//
+// Per-directory files are loaded lazily the first time a path below their
+// directory is checked.
+type IgnoreMatcher struct {
+	root     string                  // Directory the per-directory files are searched from
+	prefix   string                  // Slash path of the project directory relative to root
+	fileName string                  // Name of the per-directory ignore file
+	global   []ignoreRule            // Rules from global files, lowest precedence first
+	dirs     map[string][]ignoreRule // Rules of each directory's ignore file, keyed by slash path
+	dirCache map[string]bool         // Ignored state of directories already checked
+	readFile func(name string) ([]byte, error)
+}
+
+// NewIgnoreMatcher creates a matcher for paths relative to projectDir that
+// reads fileName in every directory from root down (none if fileName is
+// empty). root must be
+// projectDir or one of its ancestors (e.g. the repository root), so ignore
+// files above the project still apply. Rules from globalFiles, which are
+// relative to root, come first and have the lowest precedence; missing
+// files are skipped.
+func NewIgnoreMatcher(root, projectDir, fileName string, globalFiles ...string) *IgnoreMatcher {
+	m := newIgnoreMatcher(os.ReadFile, root, projectDir, fileName)
+	for _, file := range globalFiles {
+		rules, _ := m.readIgnoreFile(file, "")
+		m.global = append(m.global, rules...)
+	}
+	return m
+}
+
+// newIgnoreMatcher is NewIgnoreMatcher without global files, reading ignore
+// files with readFile, e.g. from a Git tree rather than the filesystem.
+func newIgnoreMatcher(readFile func(name string) ([]byte, error), root, projectDir, fileName string) *IgnoreMatcher {
+	m := &IgnoreMatcher{
+		root:     root,
+		fileName: fileName,
+		dirs:     make(map[string][]ignoreRule),
+		dirCache: make(map[string]bool),
+		readFile: readFile,
+	}
+	if rel, err := filepath.Rel(root, projectDir); err == nil && rel != "." {
+		m.prefix = filepath.ToSlash(rel)
+	}
+	return m
+}
+
+// NewGitIgnoreMatcher returns an IgnoreMatcher with Git's rules for
+// projectDir: .gitignore files from the repository root down,
+// .git/info/exclude and core.excludesFile. Outside a repository only the
+// .gitignore files from projectDir down are used.
+func NewGitIgnoreMatcher(projectDir string) *IgnoreMatcher {
+	root := findGitRoot(projectDir)
+	if root == "" {
+		return NewIgnoreMatcher(projectDir, projectDir, ".gitignore", globalExcludesFile(projectDir))
+	}
+	return NewIgnoreMatcher(root, projectDir, ".gitignore",
+		globalExcludesFile(projectDir), filepath.Join(root, ".git", "info", "exclude"))
+}
+
+// Project-local files that record what belongs in the context.
+const (
+	ComoIgnoreFile  = ".comoignore"  // Gitignore syntax, in any directory
+	ComoIncludeFile = ".comoinclude" // Gitignore syntax allowlist, project root only
+)
+
+// NewComoIgnoreMatcher returns a matcher for the .comoignore files in
+// projectDir and its subdirectories.
+func NewComoIgnoreMatcher(projectDir string) *IgnoreMatcher {
+	return newComoIgnoreMatcher(os.ReadFile, projectDir)
+}
+
+// NewComoIncludeMatcher returns the allowlist in projectDir/.comoinclude for
+// use with Listed, or nil if the project has none.
+func NewComoIncludeMatcher(projectDir string) *IgnoreMatcher {
+	return newComoIncludeMatcher(os.ReadFile, projectDir)
+}
+
+func newComoIgnoreMatcher(readFile func(name string) ([]byte, error), projectDir string) *IgnoreMatcher {
+	return newIgnoreMatcher(readFile, projectDir, projectDir, ComoIgnoreFile)
+}
+
+func newComoIncludeMatcher(readFile func(name string) ([]byte, error), projectDir string) *IgnoreMatcher {
+	file := filepath.Join(projectDir, ComoIncludeFile)
+	m := newIgnoreMatcher(readFile, projectDir, projectDir, "")
+	rules, found := m.readIgnoreFile(file, "")
+	if !found {
+		return nil
+	}
+	Log.Verbosef("  Using allowlist %s", file)
+	m.global = rules
+	return m
+}
+
+// findGitRoot returns the nearest directory at or above dir containing a
+// .git entry, or "".
+func findGitRoot(dir string) string {
+	for {
+		if _, err := os.Lstat(filepath.Join(dir, ".git")); err == nil {
+			return dir
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// globalExcludesFile returns the path of Git's global excludes file:
+// core.excludesFile if configured, else $XDG_CONFIG_HOME/git/ignore.
+func globalExcludesFile(dir string) string {
+	if out, err := runGit(dir, "config", "--path", "--get", "core.excludesFile"); err == nil && out != "" {
+		return out
+	}
+	if xdg := os.Getenv("XDG_CONFIG_HOME"); xdg != "" {
+		return filepath.Join(xdg, "git", "ignore")
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		return filepath.Join(home, ".config", "git", "ignore")
+	}
+	return ""
+}
+
+// Ignored reports whether relPath (relative to the project directory) is
+// ignored, either itself or because one of its parent directories is.
+func (m *IgnoreMatcher) Ignored(relPath string, isDir bool) bool {
+	slashPath := filepath.ToSlash(relPath)
+	if slashPath == "." || slashPath == "" {
+		return false
+	}
+
+	// Parent directories inside the project first
+	parts := strings.Split(slashPath, "/")
+	for i := 1; i < len(parts); i++ {
+		if m.dirIgnored(strings.Join(parts[:i], "/")) {
+			return true
+		}
+	}
+	if isDir {
+		return m.dirIgnored(slashPath)
+	}
+	return m.matches(m.fullPath(slashPath), false)
+}
+
+func (m *IgnoreMatcher) dirIgnored(slashPath string) bool {
+	if ignored, ok := m.dirCache[slashPath]; ok {
+		return ignored
+	}
+	ignored := m.matches(m.fullPath(slashPath), true)
+	m.dirCache[slashPath] = ignored
+	return ignored
+}
+
+func (m *IgnoreMatcher) fullPath(slashPath string) string {
+	if m.prefix == "" {
+		return slashPath
+	}
+	return m.prefix + "/" + slashPath
+}
+
+// matches applies the rules visible to fullPath (relative to root).
+func (m *IgnoreMatcher) matches(fullPath string, isDir bool) bool {
+	_, matched := m.lookup(fullPath, isDir)
+	return matched
+}
+
+// lookup finds the rule that decides fullPath, trying the deepest ignore
+// file and its last line first. It reports whether any rule matched and,
+// if so, whether the path is matched (false for a negated rule).
+func (m *IgnoreMatcher) lookup(fullPath string, isDir bool) (bool, bool) {
+	// Directories holding applicable ignore files, deepest first
+	var dirs []string
+	for dir := path.Dir(fullPath); dir != "."; dir = path.Dir(dir) {
+		dirs = append(dirs, dir)
+	}
+	dirs = append(dirs, "")
+
+	for _, dir := range dirs {
+		rules := m.dirRules(dir)
+		for i := len(rules) - 1; i >= 0; i-- {
+			if matched, negate := rules[i].match(fullPath, isDir); matched {
+				return true, !negate
+			}
+		}
+	}
+	for i := len(m.global) - 1; i >= 0; i-- {
+		if matched, negate := m.global[i].match(fullPath, isDir); matched {
+			return true, !negate
+		}
+	}
+	return false, false
+}
+
+// Listed reports whether relPath is selected by the matcher used as an
+// allowlist: the path itself or, failing that, its nearest parent directory
+// with a matching rule decides. Unlike Ignored, a negated rule can take a
+// path back out of a listed directory.
+func (m *IgnoreMatcher) Listed(relPath string, isDir bool) bool {
+	slashPath := filepath.ToSlash(relPath)
+	for p := slashPath; p != "." && p != ""; p = path.Dir(p) {
+		if decided, matched := m.lookup(m.fullPath(p), isDir || p != slashPath); decided {
+			return matched
+		}
+	}
+	return false
+}
+
+// dirRules returns the rules of the ignore file in dir, loading it once.
+func (m *IgnoreMatcher) dirRules(dir string) []ignoreRule {
+	if rules, ok := m.dirs[dir]; ok || m.fileName == "" {
+		return rules
+	}
+	rules, _ := m.readIgnoreFile(filepath.Join(m.root, filepath.FromSlash(dir), m.fileName), dir)
+	m.dirs[dir] = rules
+	return rules
+}
+
+// match reports whether the rule matches fullPath and, if so, whether it
+// re-includes it.
+func (r ignoreRule) match(fullPath string, isDir bool) (bool, bool) {
+	if r.dirOnly && !isDir {
+		return false, false
+	}
+	rel := fullPath
+	if r.base != "" {
+		if !strings.HasPrefix(fullPath, r.base+"/") {
+			return false, false
+		}
+		rel = fullPath[len(r.base)+1:]
+	}
+	return r.re.MatchString(rel), r.negate
+}
+
+// readIgnoreFile compiles the patterns in file, relative to base, and
+// reports whether the file exists. A missing or unreadable file has no
+// rules.
+func (m *IgnoreMatcher) readIgnoreFile(file, base string) ([]ignoreRule, bool) {
+	if file == "" {
+		return nil, false
+	}
+	data, err := m.readFile(file)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, false
+	}
+	if err != nil {
+		Log.Warnf("could not read ignore file %s: %v", file, err)
+		return nil, true
+	}
+
+	Log.Debugf("loading ignore rules from %s", file)
+	var rules []ignoreRule
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		if rule, ok := compileIgnorePattern(scanner.Text(), base); ok {
+			rules = append(rules, rule)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		Log.Warnf("could not read ignore file %s: %v", file, err)
+	}
+	return rules, true
+}
+
+// compileIgnorePattern compiles one gitignore line. It returns false for
+// blank lines and comments.
+func compileIgnorePattern(line, base string) (ignoreRule, bool) {
+	line = strings.TrimSuffix(line, "\r")
+	// Trailing spaces are ignored unless escaped with a backslash
+	for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, "\\ ") {
+		line = line[:len(line)-1]
+	}
+	if line == "" || strings.HasPrefix(line, "#") {
+		return ignoreRule{}, false
+	}
+
+	rule := ignoreRule{base: base}
+	if strings.HasPrefix(line, "!") {
+		rule.negate = true
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		rule.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if line == "" {
+		return ignoreRule{}, false
+	}
+
+	// A pattern with a slash is anchored to base; otherwise it matches at
+	// any depth.
+	if strings.HasPrefix(line, "/") {
+		line = line[1:]
+	} else if !strings.Contains(line, "/") {
+		line = "**/" + line
+	}
+
+	re, err := regexp.Compile("^" + ignorePatternToRegexp(line) + "$")
+	if err != nil {
+		Log.Warnf("skipping invalid ignore pattern %q: %v", line, err)
+		return ignoreRule{}, false
+	}
+	rule.re = re
+	return rule, true
+}
+
+// ignorePatternToRegexp translates gitignore wildcards into a regular
+// expression: "*" and "?" stop at slashes, "**" spans directories when it
+// is a whole path segment, and "[...]" is a character class.
+func ignorePatternToRegexp(pattern string) string {
+	var b strings.Builder
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch {
+		case c == '*' && strings.HasPrefix(pattern[i:], "**") && (i == 0 || pattern[i-1] == '/') &&
+			(i+2 == len(pattern) || pattern[i+2] == '/'):
+			if i+2 == len(pattern) {
+				// Trailing "/**": everything inside
+				b.WriteString(".*")
+				i++
+			} else {
+				// Leading "**/" or "/**/": zero or more directories
+				b.WriteString("(?:.*/)?")
+				i += 2
+			}
+		case c == '*':
+			b.WriteString("[^/]*")
+		case c == '?':
+			b.WriteString("[^/]")
+		case c == '[':
+			// A "]" right after "[" or "[!" is part of the class
+			j := i + 1
+			if j < len(pattern) && (pattern[j] == '!' || pattern[j] == '^') {
+				j++
+			}
+			if j < len(pattern) && pattern[j] == ']' {
+				j++
+			}
+			end := strings.IndexByte(pattern[j:], ']')
+			if end < 0 {
+				b.WriteString(`\[`)
+				continue
+			}
+			class := pattern[i+1 : j+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + class + "]")
+			i = j + end
+		case c == '\\' && i+1 < len(pattern):
+			i++
+			b.WriteString(regexp.QuoteMeta(string(pattern[i])))
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return b.String()
+}
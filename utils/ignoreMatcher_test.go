@@ -0,0 +1,188 @@
+package utils
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// ignoreCase is a set of .gitignore files and the paths they ignore, as
+// reported by git check-ignore.
+type ignoreCase struct {
+	name    string
+	files   map[string]string // .gitignore content by directory ("" for the root)
+	paths   []string          // Paths to check; a trailing slash marks a directory
+	ignored []string          // The paths git check-ignore reports
+}
+
+var ignoreCases = []ignoreCase{
+	{
+		name:    "negation",
+		files:   map[string]string{"": "*.log\n!keep.log\n"},
+		paths:   []string{"a.log", "keep.log", "sub/b.log", "sub/keep.log", "a.txt"},
+		ignored: []string{"a.log", "sub/b.log"},
+	},
+	{
+		name:    "negation inside an ignored directory",
+		files:   map[string]string{"": "logs/\n!logs/keep.log\n"},
+		paths:   []string{"logs/", "logs/keep.log", "logs/a.log"},
+		ignored: []string{"logs/", "logs/keep.log", "logs/a.log"},
+	},
+	{
+		name:    "negated directory contents",
+		files:   map[string]string{"": "logs/*\n!logs/keep.log\n"},
+		paths:   []string{"logs/", "logs/keep.log", "logs/a.log"},
+		ignored: []string{"logs/a.log"},
+	},
+	{
+		name:    "anchoring",
+		files:   map[string]string{"": "/root.txt\nsub/x.txt\nany.txt\n"},
+		paths:   []string{"root.txt", "sub/root.txt", "sub/x.txt", "a/sub/x.txt", "any.txt", "a/b/any.txt"},
+		ignored: []string{"root.txt", "sub/x.txt", "any.txt", "a/b/any.txt"},
+	},
+	{
+		name:  "double star",
+		files: map[string]string{"": "**/gen/*.go\ndocs/**/*.md\na/**/b\n**/cache\n"},
+		paths: []string{
+			"gen/x.go", "src/gen/x.go", "src/gen/sub/x.go",
+			"docs/a.md", "docs/x/y/a.md", "src/docs/a.md",
+			"a/b", "a/x/b", "a/x/y/b", "x/a/b",
+			"cache/", "deep/er/cache/", "deep/er/cache/file",
+		},
+		ignored: []string{
+			"gen/x.go", "src/gen/x.go",
+			"docs/a.md", "docs/x/y/a.md",
+			"a/b", "a/x/b", "a/x/y/b",
+			"cache/", "deep/er/cache/", "deep/er/cache/file",
+		},
+	},
+	{
+		name:    "directory-only rules",
+		files:   map[string]string{"": "build/\nout/bin/\n"},
+		paths:   []string{"build/", "build/app", "sub/build/", "sub/build/app", "x/build", "out/bin/", "out/bin/app", "sub/out/bin/"},
+		ignored: []string{"build/", "build/app", "sub/build/", "sub/build/app", "out/bin/", "out/bin/app"},
+	},
+	{
+		name:    "character classes",
+		files:   map[string]string{"": "*.[oa]\nfile[0-9].txt\n[!a]x.txt\n"},
+		paths:   []string{"main.o", "lib.a", "main.c", "file1.txt", "fileA.txt", "bx.txt", "ax.txt"},
+		ignored: []string{"main.o", "lib.a", "file1.txt", "bx.txt"},
+	},
+	{
+		name:    "escaped hash and bang",
+		files:   map[string]string{"": "#comment.txt\n\\#hash.txt\n\\!bang.txt\n"},
+		paths:   []string{"#comment.txt", "#hash.txt", "!bang.txt", "bang.txt"},
+		ignored: []string{"#hash.txt", "!bang.txt"},
+	},
+	{
+		name:    "trailing spaces",
+		files:   map[string]string{"": "trail.txt   \nspace\\ \n"},
+		paths:   []string{"trail.txt", "trail.txt   ", "space ", "space"},
+		ignored: []string{"trail.txt", "space "},
+	},
+	{
+		name: "nested .gitignore files",
+		files: map[string]string{
+			"":         "*.tmp\n/top.txt\n",
+			"sub":      "!keep.tmp\n/only-here.txt\n",
+			"sub/deep": "*.txt\n",
+		},
+		paths:   []string{"a.tmp", "keep.tmp", "sub/a.tmp", "sub/keep.tmp", "top.txt", "sub/top.txt", "only-here.txt", "sub/only-here.txt", "sub/x/only-here.txt", "sub/deep/a.txt", "sub/b.txt"},
+		ignored: []string{"a.tmp", "keep.tmp", "sub/a.tmp", "top.txt", "sub/only-here.txt", "sub/deep/a.txt"},
+	},
+}
+
+func TestIgnoreMatcher(t *testing.T) {
+	for _, tc := range ignoreCases {
+		t.Run(tc.name, func(t *testing.T) {
+			root := writeIgnoreFixture(t, tc)
+			m := NewIgnoreMatcher(root, root, ".gitignore")
+			for _, p := range tc.paths {
+				isDir := strings.HasSuffix(p, "/")
+				got := m.Ignored(filepath.FromSlash(strings.TrimSuffix(p, "/")), isDir)
+				if want := slices.Contains(tc.ignored, p); got != want {
+					t.Errorf("Ignored(%q) = %v, want %v", p, got, want)
+				}
+			}
+		})
+	}
+}
+
+// TestIgnoreFixturesMatchGit checks the expected results of ignoreCases
+// against git check-ignore, so the fixtures stay true to Git.
+func TestIgnoreFixturesMatchGit(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	for _, tc := range ignoreCases {
+		t.Run(tc.name, func(t *testing.T) {
+			root := writeIgnoreFixture(t, tc)
+			git := func(stdin string, args ...string) string {
+				cmd := exec.Command("git", args...)
+				cmd.Dir = root
+				cmd.Stdin = strings.NewReader(stdin)
+				// Keep the user's and the system's excludes out
+				cmd.Env = append(os.Environ(), "GIT_CONFIG_NOSYSTEM=1", "GIT_CONFIG_GLOBAL="+os.DevNull, "XDG_CONFIG_HOME="+t.TempDir())
+				out, err := cmd.Output()
+				if exitErr, ok := err.(*exec.ExitError); err != nil && !(ok && exitErr.ExitCode() == 1) {
+					t.Fatalf("git %s: %v", strings.Join(args, " "), err)
+				}
+				return string(out)
+			}
+			git("", "init", "-q")
+
+			var stdin strings.Builder
+			for _, p := range tc.paths {
+				stdin.WriteString(strings.TrimSuffix(p, "/") + "\x00")
+			}
+			out := git(stdin.String(), "check-ignore", "--no-index", "--stdin", "-z")
+			var ignored []string
+			for _, p := range strings.Split(strings.TrimSuffix(out, "\x00"), "\x00") {
+				if p != "" {
+					ignored = append(ignored, p)
+				}
+			}
+			for _, p := range tc.paths {
+				got := slices.Contains(ignored, strings.TrimSuffix(p, "/"))
+				if want := slices.Contains(tc.ignored, p); got != want {
+					t.Errorf("git check-ignore %q = %v, fixture says %v", p, got, want)
+				}
+			}
+		})
+	}
+}
+
+// writeIgnoreFixture creates the case's .gitignore files, directories and
+// empty files in a temporary directory and returns it.
+func writeIgnoreFixture(t *testing.T, tc ignoreCase) string {
+	t.Helper()
+	root := t.TempDir()
+	for _, p := range tc.paths {
+		full := filepath.Join(root, filepath.FromSlash(p))
+		if strings.HasSuffix(p, "/") {
+			if err := os.MkdirAll(full, 0755); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(full, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for dir, content := range tc.files {
+		full := filepath.Join(root, filepath.FromSlash(dir))
+		if err := os.MkdirAll(full, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(full, ".gitignore"), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
@@ -0,0 +1,186 @@
+package utils
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// FileRecord is the machine-readable description of one bundled file, used
+// by the json and jsonl output formats.
+type FileRecord struct {
+	Path     string `json:"path"`               // Path relative to the project root, slash-separated
+	Size     int64  `json:"size"`               // Size in bytes
+	SHA256   string `json:"sha256"`             // Hex-encoded SHA-256 of the file content
+	Binary   bool   `json:"binary"`             // True if the file was detected as binary
+	Language string `json:"language,omitempty"` // Language inferred from name, extension or shebang
+	Content  string `json:"content"`            // File content (empty for binary files)
+
+	// Set when the record holds only a range of lines of a split file.
+	LineStart  int `json:"line_start,omitempty"`
+	LineEnd    int `json:"line_end,omitempty"`
+	TotalLines int `json:"total_lines,omitempty"`
+
+	// Set when the content was cut off at the --max-file-size limit.
+	Truncated    bool  `json:"truncated,omitempty"`
+	OriginalSize int64 `json:"original_size,omitempty"`
+
+	// Names of the transforms (--transform) that rewrote the content.
+	Transforms []string `json:"transforms,omitempty"`
+
+	// Set when every content line starts with its number (--line-numbers).
+	LineNumbers bool `json:"line_numbers,omitempty"`
+}
+
+// HeaderRecord is the first line of a jsonl bundle that is one part of a
+// split bundle, has a tree or was made with --header.
+type HeaderRecord struct {
+	Part       int    `json:"part,omitempty"`
+	TotalParts int    `json:"total_parts,omitempty"`
+	Header     string `json:"header,omitempty"`
+	Tree       string `json:"tree,omitempty"`
+}
+
+// SkippedLineRecord is a line of a jsonl bundle naming a file that was left
+// out, written after the file records.
+type SkippedLineRecord struct {
+	Skipped SkippedRecord `json:"skipped"`
+}
+
+// SkippedRecord names a listed file that was left out of the bundle.
+type SkippedRecord struct {
+	Path   string `json:"path"`
+	Reason string `json:"reason"`
+}
+
+// JSONDocument is the single document written by the json output format.
+type JSONDocument struct {
+	Project    string          `json:"project"`
+	Part       int             `json:"part,omitempty"`
+	TotalParts int             `json:"total_parts,omitempty"`
+	Header     string          `json:"header,omitempty"`
+	Tree       string          `json:"tree,omitempty"`
+	Files      []FileRecord    `json:"files"`
+	Skipped    []SkippedRecord `json:"skipped,omitempty"`
+}
+
+// NewFileRecord builds the record for a rendered file. Binary files are
+// hashed and sized from disk since their content is not loaded. For
+// streamed files, Content is left empty (see writeFileRecord).
+func NewFileRecord(file RenderFile) (FileRecord, error) {
+	record := FileRecord{
+		Path:   filepath.ToSlash(file.RelPath),
+		Binary: file.IsBinary,
+	}
+
+	if file.IsBinary {
+		sum, size, err := hashFile(file.FileInfo)
+		if err != nil {
+			return FileRecord{}, err
+		}
+		record.SHA256 = sum
+		record.Size = size
+		return record, nil
+	}
+
+	if file.Stream != nil {
+		sum, size, err := hashStream(file.Stream)
+		if err != nil {
+			return FileRecord{}, err
+		}
+		record.SHA256, record.Size = sum, size
+	} else {
+		record.SHA256 = hashContent(file.Content)
+		record.Size = int64(len(file.Content))
+		record.Content = file.Content
+	}
+	record.Language = file.Language
+	record.LineStart, record.LineEnd, record.TotalLines = file.LineStart, file.LineEnd, file.TotalLines
+	if file.Truncated {
+		record.Truncated, record.OriginalSize = true, file.OriginalSize
+	}
+	record.Transforms, record.LineNumbers = file.Transforms, file.LineNumbers
+	return record, nil
+}
+
+// writeFileRecord writes the record of file to w as JSON, without a trailing
+// newline, indented as by json.Encoder with prefix and indent. The content
+// of a streamed file is copied into the "content" string from disk.
+func writeFileRecord(w io.Writer, file RenderFile, prefix, indent string) error {
+	record, err := NewFileRecord(file)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	encodeJSONValue(&buf, record, prefix, indent)
+	data := buf.Bytes()
+
+	if file.Stream != nil {
+		// Split the encoded record inside its empty content string
+		marker := []byte(`"content":""`)
+		if indent != "" {
+			marker = []byte(`"content": ""`)
+		}
+		cut := bytes.Index(data, marker) + len(marker) - 1
+		if _, err := w.Write(data[:cut]); err != nil {
+			return fmt.Errorf("failed to write JSON record for %s: %w", record.Path, err)
+		}
+		jw := &jsonStringWriter{w: w}
+		if err := file.Stream.copyTo(jw); err != nil {
+			return err
+		}
+		if err := jw.Close(); err != nil {
+			return fmt.Errorf("failed to write JSON record for %s: %w", record.Path, err)
+		}
+		data = data[cut:]
+	}
+	if _, err := w.Write(data); err != nil {
+		return fmt.Errorf("failed to write JSON record for %s: %w", record.Path, err)
+	}
+	return nil
+}
+
+// encodeJSONValue appends value to b as JSON without HTML escaping or a
+// trailing newline, indented as by json.Encoder with prefix and indent.
+func encodeJSONValue(b *bytes.Buffer, value any, prefix, indent string) {
+	enc := json.NewEncoder(b)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent(prefix, indent)
+	_ = enc.Encode(value) // Records and strings always encode
+	b.Truncate(b.Len() - 1)
+}
+
+// hashContent returns the hex SHA-256 of content.
+func hashContent(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+// hashFile returns the hex SHA-256 and size of a listed file.
+func hashFile(fi FileInfo) (string, int64, error) {
+	if fi.Blob != nil {
+		content, err := fi.Blob.Read()
+		if err != nil {
+			return "", 0, err
+		}
+		return hashContent(string(content)), int64(len(content)), nil
+	}
+
+	f, err := os.Open(fi.AbsPath)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to open file %s: %w", fi.AbsPath, err)
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to hash file %s: %w", fi.AbsPath, err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), n, nil
+}
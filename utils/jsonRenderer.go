@@ -0,0 +1,178 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+)
+
+// jsonRenderer writes a single JSONDocument, indented as by json.Encoder.
+// Files are written as they arrive rather than collected, so streamed file
+// content is never held in memory.
+type jsonRenderer struct {
+	w       io.Writer
+	doc     JSONDocument // Fields before "files", and the skipped files
+	started bool         // The fields up to the opening of "files" are written
+	files   int
+}
+
+func (r *jsonRenderer) BeginDocument(doc DocumentInfo) error {
+	r.doc = JSONDocument{Project: doc.ProjectName, Part: doc.Part, TotalParts: doc.TotalParts, Header: doc.Header}
+	r.started, r.files = false, 0
+	return nil
+}
+
+func (r *jsonRenderer) WriteTree(tree string) error {
+	r.doc.Tree = tree
+	return nil
+}
+
+// writeHead writes the document's fields up to the opening of "files".
+func (r *jsonRenderer) writeHead() error {
+	r.started = true
+	var b bytes.Buffer
+	b.WriteString("{\n")
+	field := func(key string, value any) {
+		fmt.Fprintf(&b, "  %q: ", key)
+		encodeJSONValue(&b, value, "", "")
+		b.WriteString(",\n")
+	}
+	field("project", r.doc.Project)
+	if r.doc.Part != 0 {
+		field("part", r.doc.Part)
+	}
+	if r.doc.TotalParts != 0 {
+		field("total_parts", r.doc.TotalParts)
+	}
+	if r.doc.Header != "" {
+		field("header", r.doc.Header)
+	}
+	if r.doc.Tree != "" {
+		field("tree", r.doc.Tree)
+	}
+	b.WriteString(`  "files": [`)
+	if _, err := r.w.Write(b.Bytes()); err != nil {
+		return fmt.Errorf("failed to write JSON document: %w", err)
+	}
+	return nil
+}
+
+func (r *jsonRenderer) WriteFile(file RenderFile) error {
+	if !r.started {
+		if err := r.writeHead(); err != nil {
+			return err
+		}
+	}
+	separator := ",\n    "
+	if r.files == 0 {
+		separator = "\n    "
+	}
+	r.files++
+	if _, err := io.WriteString(r.w, separator); err != nil {
+		return fmt.Errorf("failed to write JSON document: %w", err)
+	}
+	return writeFileRecord(r.w, file, "    ", "  ")
+}
+
+func (r *jsonRenderer) SkipFile(file FileInfo, reason string) error {
+	r.doc.Skipped = append(r.doc.Skipped, SkippedRecord{Path: filepath.ToSlash(file.RelPath), Reason: reason})
+	return nil
+}
+
+func (r *jsonRenderer) EndDocument() error {
+	if !r.started {
+		if err := r.writeHead(); err != nil {
+			return err
+		}
+	}
+	var b bytes.Buffer
+	if r.files > 0 {
+		b.WriteString("\n  ")
+	}
+	b.WriteString("]")
+	if len(r.doc.Skipped) > 0 {
+		b.WriteString(",\n  \"skipped\": ")
+		encodeJSONValue(&b, r.doc.Skipped, "  ", "  ")
+	}
+	b.WriteString("\n}\n")
+	if _, err := r.w.Write(b.Bytes()); err != nil {
+		return fmt.Errorf("failed to write JSON document: %w", err)
+	}
+	return nil
+}
+
+// jsonlRenderer streams one FileRecord per line as files arrive. Part
+// numbers, the header and the tree go into a first HeaderRecord line, and
+// each skipped file gets a SkippedLineRecord line at the end.
+type jsonlRenderer struct {
+	w       io.Writer
+	head    HeaderRecord
+	started bool // The HeaderRecord line, if any, is written
+	skipped []SkippedRecord
+}
+
+func (r *jsonlRenderer) BeginDocument(doc DocumentInfo) error {
+	r.head = HeaderRecord{Part: doc.Part, TotalParts: doc.TotalParts, Header: doc.Header}
+	r.started, r.skipped = false, nil
+	return nil
+}
+
+func (r *jsonlRenderer) WriteTree(tree string) error {
+	r.head.Tree = tree
+	return nil
+}
+
+// writeRecord writes value as one line.
+func (r *jsonlRenderer) writeRecord(value any) error {
+	enc := json.NewEncoder(r.w)
+	enc.SetEscapeHTML(false)
+	return enc.Encode(value)
+}
+
+// writeHead writes the HeaderRecord line, unless it would be empty.
+func (r *jsonlRenderer) writeHead() error {
+	r.started = true
+	if r.head == (HeaderRecord{}) {
+		return nil
+	}
+	if err := r.writeRecord(r.head); err != nil {
+		return fmt.Errorf("failed to write JSON header record: %w", err)
+	}
+	return nil
+}
+
+func (r *jsonlRenderer) WriteFile(file RenderFile) error {
+	if !r.started {
+		if err := r.writeHead(); err != nil {
+			return err
+		}
+	}
+	if err := writeFileRecord(r.w, file, "", ""); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(r.w, "\n"); err != nil {
+		return fmt.Errorf("failed to write JSON record for %s: %w", file.RelPath, err)
+	}
+	return nil
+}
+
+func (r *jsonlRenderer) SkipFile(file FileInfo, reason string) error {
+	r.skipped = append(r.skipped, SkippedRecord{Path: filepath.ToSlash(file.RelPath), Reason: reason})
+	return nil
+}
+
+func (r *jsonlRenderer) EndDocument() error {
+	if !r.started {
+		if err := r.writeHead(); err != nil {
+			return err
+		}
+	}
+	for _, skipped := range r.skipped {
+		if err := r.writeRecord(SkippedLineRecord{Skipped: skipped}); err != nil {
+			return fmt.Errorf("failed to write JSON record for skipped file %s: %w", skipped.Path, err)
+		}
+	}
+	return nil
+}
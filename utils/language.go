@@ -0,0 +1,187 @@
+package utils
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// languageByExtension maps lower-case file extensions to the language tags
+// commonly understood by Markdown renderers and LLMs.
+var languageByExtension = map[string]string{
+	".go":         "go",
+	".py":         "python",
+	".pyi":        "python",
+	".rb":         "ruby",
+	".rs":         "rust",
+	".java":       "java",
+	".kt":         "kotlin",
+	".kts":        "kotlin",
+	".scala":      "scala",
+	".swift":      "swift",
+	".c":          "c",
+	".h":          "c",
+	".cc":         "cpp",
+	".cpp":        "cpp",
+	".cxx":        "cpp",
+	".hpp":        "cpp",
+	".hh":         "cpp",
+	".cs":         "csharp",
+	".m":          "objectivec",
+	".php":        "php",
+	".js":         "javascript",
+	".mjs":        "javascript",
+	".cjs":        "javascript",
+	".jsx":        "jsx",
+	".ts":         "typescript",
+	".mts":        "typescript",
+	".cts":        "typescript",
+	".tsx":        "tsx",
+	".vue":        "vue",
+	".svelte":     "svelte",
+	".html":       "html",
+	".htm":        "html",
+	".css":        "css",
+	".scss":       "scss",
+	".sass":       "sass",
+	".less":       "less",
+	".json":       "json",
+	".jsonl":      "json",
+	".yaml":       "yaml",
+	".yml":        "yaml",
+	".toml":       "toml",
+	".ini":        "ini",
+	".cfg":        "ini",
+	".xml":        "xml",
+	".svg":        "xml",
+	".md":         "markdown",
+	".markdown":   "markdown",
+	".rst":        "rst",
+	".sql":        "sql",
+	".sh":         "bash",
+	".bash":       "bash",
+	".zsh":        "zsh",
+	".fish":       "fish",
+	".ps1":        "powershell",
+	".bat":        "batch",
+	".cmd":        "batch",
+	".lua":        "lua",
+	".pl":         "perl",
+	".pm":         "perl",
+	".r":          "r",
+	".dart":       "dart",
+	".ex":         "elixir",
+	".exs":        "elixir",
+	".erl":        "erlang",
+	".hs":         "haskell",
+	".clj":        "clojure",
+	".ml":         "ocaml",
+	".zig":        "zig",
+	".tf":         "hcl",
+	".hcl":        "hcl",
+	".proto":      "protobuf",
+	".graphql":    "graphql",
+	".gql":        "graphql",
+	".mk":         "makefile",
+	".cmake":      "cmake",
+	".dockerfile": "dockerfile",
+	".diff":       "diff",
+	".patch":      "diff",
+	".tmpl":       "gotemplate",
+	".gotmpl":     "gotemplate",
+}
+
+// languageByFilename maps well-known extension-less file names to languages.
+var languageByFilename = map[string]string{
+	"makefile":       "makefile",
+	"gnumakefile":    "makefile",
+	"dockerfile":     "dockerfile",
+	"containerfile":  "dockerfile",
+	"cmakelists.txt": "cmake",
+	"go.mod":         "go.mod",
+	"go.sum":         "text",
+	"gemfile":        "ruby",
+	"rakefile":       "ruby",
+	"vagrantfile":    "ruby",
+	"jenkinsfile":    "groovy",
+	".bashrc":        "bash",
+	".zshrc":         "zsh",
+	".profile":       "bash",
+	".gitignore":     "gitignore",
+	".dockerignore":  "gitignore",
+}
+
+// languageByInterpreter maps shebang interpreters to languages.
+var languageByInterpreter = map[string]string{
+	"sh":      "bash",
+	"bash":    "bash",
+	"zsh":     "zsh",
+	"fish":    "fish",
+	"python":  "python",
+	"python2": "python",
+	"python3": "python",
+	"node":    "javascript",
+	"deno":    "typescript",
+	"ruby":    "ruby",
+	"perl":    "perl",
+	"php":     "php",
+	"lua":     "lua",
+	"Rscript": "r",
+}
+
+// DetectLanguage infers a language tag for a file from its name, extension
+// or shebang line. It returns an empty string when nothing matches.
+func DetectLanguage(relPath string, content string) string {
+	base := filepath.Base(relPath)
+	lowerBase := strings.ToLower(base)
+
+	if lang, ok := languageByFilename[lowerBase]; ok {
+		return lang
+	}
+	if strings.HasPrefix(lowerBase, "dockerfile.") || strings.HasPrefix(lowerBase, "containerfile.") {
+		return "dockerfile"
+	}
+	if strings.HasPrefix(lowerBase, "makefile.") {
+		return "makefile"
+	}
+
+	if lang, ok := languageByExtension[strings.ToLower(filepath.Ext(base))]; ok {
+		return lang
+	}
+
+	return languageFromShebang(content)
+}
+
+// languageFromShebang returns the language of the interpreter named on a
+// leading "#!" line, handling the "/usr/bin/env [-S] interpreter" form.
+func languageFromShebang(content string) string {
+	if !strings.HasPrefix(content, "#!") {
+		return ""
+	}
+	line := content[2:]
+	if idx := strings.IndexByte(line, '\n'); idx >= 0 {
+		line = line[:idx]
+	}
+
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return ""
+	}
+	interpreter := filepath.Base(fields[0])
+	if interpreter == "env" {
+		interpreter = ""
+		for _, f := range fields[1:] {
+			if strings.HasPrefix(f, "-") || strings.Contains(f, "=") {
+				continue
+			}
+			interpreter = filepath.Base(f)
+			break
+		}
+	}
+
+	if lang, ok := languageByInterpreter[interpreter]; ok {
+		return lang
+	}
+	// Versioned interpreters such as python3.12 or ruby3.2
+	trimmed := strings.TrimRight(interpreter, "0123456789.")
+	return languageByInterpreter[trimmed]
+}
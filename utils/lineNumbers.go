@@ -0,0 +1,54 @@
+package utils
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// lineNumberPrefix matches the prefix numberLines puts before a line. The
+// space after the bar may have been trimmed from empty lines.
+var lineNumberPrefix = regexp.MustCompile(`^ *\d+ \|( |$)`)
+
+// numberLines prefixes every line of content with its number, right-aligned
+// to the width of the last one, e.g. " 9 | " and "10 | ". Numbering starts
+// at first.
+func numberLines(content string, first int) string {
+	if content == "" {
+		return ""
+	}
+	last := first + strings.Count(strings.TrimSuffix(content, "\n"), "\n")
+	width := len(strconv.Itoa(last))
+
+	var b strings.Builder
+	b.Grow(len(content) + (last-first+1)*(width+3))
+	n := first
+	for lineStart := 0; lineStart < len(content); n++ {
+		lineEnd := nextLine(content, lineStart)
+		num := strconv.Itoa(n)
+		b.WriteString(strings.Repeat(" ", width-len(num)))
+		b.WriteString(num)
+		b.WriteString(" | ")
+		b.WriteString(content[lineStart:lineEnd])
+		lineStart = lineEnd
+	}
+	return b.String()
+}
+
+// stripLineNumbers removes the prefixes added by numberLines. Lines without
+// one, e.g. added by a model editing the bundle, are kept as they are.
+func stripLineNumbers(content string) string {
+	var b strings.Builder
+	b.Grow(len(content))
+	for lineStart := 0; lineStart < len(content); {
+		lineEnd := nextLine(content, lineStart)
+		line := content[lineStart:lineEnd]
+		body := strings.TrimRight(line, "\r\n")
+		if loc := lineNumberPrefix.FindStringIndex(body); loc != nil {
+			line = line[loc[1]:]
+		}
+		b.WriteString(line)
+		lineStart = lineEnd
+	}
+	return b.String()
+}
@@ -0,0 +1,209 @@
+package utils
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNumberLines(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		first   int
+		want    string
+	}{
+		{"empty", "", 1, ""},
+		{"single line", "a\n", 1, "1 | a\n"},
+		{"no final newline", "a\nb", 1, "1 | a\n2 | b"},
+		{"empty line", "a\n\nb\n", 1, "1 | a\n2 | \n3 | b\n"},
+		{"aligned to the last number", "a\nb\nc\n", 8, " 8 | a\n 9 | b\n10 | c\n"},
+		{"crlf", "a\r\nb\r\n", 1, "1 | a\r\n2 | b\r\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := numberLines(tt.content, tt.first); got != tt.want {
+				t.Errorf("numberLines(%q, %d) = %q, want %q", tt.content, tt.first, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStripLineNumbers(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"numbered", " 9 | a\n10 | b\n", "a\nb\n"},
+		{"trailing space trimmed from an empty line", "1 | a\n2 |\n3 | b", "a\n\nb"},
+		{"line added without a number", "1 | a\nadded\n2 | b\n", "a\nadded\nb\n"},
+		{"only the first prefix", "1 | 2 | a\n", "2 | a\n"},
+		{"not a prefix", "x 1 | a\n1| a\n", "x 1 | a\n1| a\n"},
+		{"crlf", "1 | a\r\n2 | b\r\n", "a\r\nb\r\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := stripLineNumbers(tt.content); got != tt.want {
+				t.Errorf("stripLineNumbers(%q) = %q, want %q", tt.content, got, tt.want)
+			}
+		})
+	}
+
+	for _, content := range []string{"", "a", "a\n", "\n\n", "x\r\ny\n", strings.Repeat("line\n", 120)} {
+		if got := stripLineNumbers(numberLines(content, 1)); got != content {
+			t.Errorf("stripLineNumbers(numberLines(%q)) = %q", content, got)
+		}
+	}
+}
+
+func TestLineNumbersRoundTrip(t *testing.T) {
+	const original = "package main\n\nfunc main() {\n\tprintln(\"hi\")\n}\n"
+	for _, format := range bundleFormats {
+		t.Run(format, func(t *testing.T) {
+			root, infos := writeTestProject(t, map[string]string{"main.go": original})
+			bundle := renderTestBundle(t, format, infos, RenderOptions{LineNumbers: true})
+			files, _, err := ParseBundle(bundle, "auto")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(files) != 1 || !files[0].LineNumbers {
+				t.Fatalf("parsed %+v, want one file marked with line numbers", files)
+			}
+			if want := numberLines(original, 1); strings.TrimSuffix(files[0].Content, "\n") != strings.TrimSuffix(want, "\n") {
+				t.Fatalf("content %q, want %q", files[0].Content, want)
+			}
+			opts := UnpackOptions{BaseHashes: BundleHashes(files)}
+
+			// Unpacking the bundle as it is changes nothing
+			changes, err := PlanUnpack(root, files, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if changes[0].Action != UnpackUnchanged {
+				t.Errorf("unchanged bundle: action %s (%s), want %s", changes[0].Action, changes[0].Reason, UnpackUnchanged)
+			}
+
+			// An edit keeps the numbers of the other lines; they are stripped
+			edited := files
+			edited[0].Content = strings.Replace(files[0].Content, `println("hi")`, `println("hello")`, 1)
+			changes, err = PlanUnpack(root, edited, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := strings.Replace(original, `println("hi")`, `println("hello")`, 1)
+			if changes[0].Action != UnpackUpdate || changes[0].File.Content != want {
+				t.Errorf("edited bundle: action %s, content %q; want %s of %q", changes[0].Action, changes[0].File.Content, UnpackUpdate, want)
+			}
+
+			// The numbered hash still detects a change on disk
+			if err := os.WriteFile(filepath.Join(root, "main.go"), []byte(original+"// changed\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			changes, err = PlanUnpack(root, edited, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if changes[0].Action != UnpackConflict {
+				t.Errorf("changed on disk: action %s, want %s", changes[0].Action, UnpackConflict)
+			}
+		})
+	}
+}
+
+func TestSplitLineNumbers(t *testing.T) {
+	var content strings.Builder
+	for i := 1; i <= 300; i++ {
+		fmt.Fprintf(&content, "line %d of the file\n", i)
+	}
+	original := content.String()
+
+	for _, format := range bundleFormats {
+		t.Run(format, func(t *testing.T) {
+			root, infos := writeTestProject(t, map[string]string{"big.txt": original})
+			newRenderer := func(w io.Writer) (Renderer, error) { return NewRenderer(format, w) }
+			out := filepath.Join(t.TempDir(), "context"+FormatExtension(format))
+			opts := SplitOptions{MaxBytes: 3000, LineNumbers: true}
+			paths, err := RenderSplitProject(newRenderer, DocumentInfo{ProjectName: "project"}, infos, out, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(paths) < 3 {
+				t.Fatalf("wrote %d parts, want the file split across several", len(paths))
+			}
+
+			var all []BundleFile
+			next := 1
+			for _, path := range paths {
+				data, err := os.ReadFile(path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				files, _, err := ParseBundle(string(data), format)
+				if err != nil {
+					t.Fatal(err)
+				}
+				all = append(all, files...)
+				for _, f := range files {
+					if f.LineStart != next || !f.LineNumbers {
+						t.Fatalf("%s: slice %d-%d (numbered %v), want one starting at %d", path, f.LineStart, f.LineEnd, f.LineNumbers, next)
+					}
+					// Numbering continues from the whole file, not from 1
+					if want := fmt.Sprintf("%d | line %d of the file", f.LineStart, f.LineStart); !strings.HasPrefix(strings.TrimLeft(f.Content, " "), want) {
+						t.Errorf("%s: slice starts with %q, want %q", path, f.Content[:min(len(f.Content), 40)], want)
+					}
+					next = f.LineEnd + 1
+				}
+			}
+			if next != 301 {
+				t.Fatalf("slices end at line %d, want 300", next-1)
+			}
+
+			// The parts together unpack to the original file
+			changes, err := PlanUnpack(root, JoinPartialFiles(all), UnpackOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(changes) != 1 || changes[0].Action != UnpackUnchanged {
+				t.Errorf("joined parts: %+v, want big.txt unchanged", changes)
+			}
+		})
+	}
+}
+
+func TestUnnumberedContentKeepsPrefixes(t *testing.T) {
+	// Content that happens to look numbered is left alone unless the
+	// bundle says it is numbered.
+	const original = "12 | not a line number\n13 | nor this\n"
+	for _, format := range bundleFormats {
+		t.Run(format, func(t *testing.T) {
+			root, infos := writeTestProject(t, map[string]string{"table.txt": original})
+			files, _, err := ParseBundle(renderTestBundle(t, format, infos, RenderOptions{}), format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if files[0].LineNumbers {
+				t.Fatal("file marked with line numbers")
+			}
+			changes, err := PlanUnpack(root, files, UnpackOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if changes[0].Action != UnpackUnchanged || changes[0].File.Content != original {
+				t.Errorf("action %s, content %q; want %s of %q", changes[0].Action, changes[0].File.Content, UnpackUnchanged, original)
+			}
+
+			// Forcing the stripping is the caller's choice
+			changes, err = PlanUnpack(root, files, UnpackOptions{StripLineNumbers: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := "not a line number\nnor this\n"; changes[0].File.Content != want {
+				t.Errorf("forced strip: content %q, want %q", changes[0].File.Content, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package utils
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// LogLevel controls how much diagnostic output is written.
+type LogLevel int
+
+const (
+	LogQuiet   LogLevel = iota // Errors only (returned to the caller, never logged here)
+	LogNormal                  // Progress messages and warnings
+	LogVerbose                 // Run configuration and per-file details
+	LogDebug                   // Internal diagnostics (git invocations, fallbacks)
+)
+
+// Logger writes diagnostics to a side channel (stderr by default) so that
+// stdout only ever carries the generated payload.
+type Logger struct {
+	mu    sync.Mutex
+	out   io.Writer
+	level LogLevel
+}
+
+// Log is the logger shared by the commands and the utils package.
+var Log = NewLogger(os.Stderr, LogNormal)
+
+// NewLogger creates a logger writing messages up to the given level to out.
+func NewLogger(out io.Writer, level LogLevel) *Logger {
+	return &Logger{out: out, level: level}
+}
+
+// SetLogger replaces the shared logger.
+func SetLogger(l *Logger) {
+	Log = l
+}
+
+// Level returns the logger's verbosity level.
+func (l *Logger) Level() LogLevel {
+	return l.level
+}
+
+// Enabled reports whether messages at the given level are written.
+func (l *Logger) Enabled(level LogLevel) bool {
+	return level <= l.level
+}
+
+// Infof writes a progress message at normal level.
+func (l *Logger) Infof(format string, args ...any) {
+	l.logf(LogNormal, "", format, args...)
+}
+
+// Warnf writes a warning at normal level.
+func (l *Logger) Warnf(format string, args ...any) {
+	l.logf(LogNormal, "Warning: ", format, args...)
+}
+
+// Verbosef writes a message shown with --verbose.
+func (l *Logger) Verbosef(format string, args ...any) {
+	l.logf(LogVerbose, "", format, args...)
+}
+
+// Debugf writes a message shown with -vv.
+func (l *Logger) Debugf(format string, args ...any) {
+	l.logf(LogDebug, "debug: ", format, args...)
+}
+
+func (l *Logger) logf(level LogLevel, prefix, format string, args ...any) {
+	if !l.Enabled(level) {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	fmt.Fprintf(l.out, prefix+format+"\n", args...)
+}
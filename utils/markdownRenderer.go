@@ -0,0 +1,117 @@
+package utils
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// markdownRenderer writes the tree and every file as fenced code blocks.
+type markdownRenderer struct {
+	w       io.Writer
+	skipped []SkippedRecord
+}
+
+func (r *markdownRenderer) BeginDocument(doc DocumentInfo) error {
+	if doc.TotalParts > 0 {
+		if _, err := fmt.Fprintf(r.w, "# %s (part %d of %d)\n\n", doc.ProjectName, doc.Part, doc.TotalParts); err != nil {
+			return fmt.Errorf("failed to write part header: %w", err)
+		}
+	}
+	if doc.Header != "" {
+		if _, err := fmt.Fprintf(r.w, "%s\n\n", strings.TrimRight(doc.Header, "\n")); err != nil {
+			return fmt.Errorf("failed to write header: %w", err)
+		}
+	}
+	return nil
+}
+
+func (r *markdownRenderer) WriteTree(tree string) error {
+	fence := CodeFence(tree)
+	if _, err := fmt.Fprintf(r.w, "## Project Structure\n\n%stext\n%s\n%s\n\n", fence, strings.TrimRight(tree, "\n"), fence); err != nil {
+		return fmt.Errorf("failed to write tree content: %w", err)
+	}
+	return nil
+}
+
+func (r *markdownRenderer) WriteFile(file RenderFile) error {
+	// Streamed content is scanned in a first pass to size the fence
+	var scan fenceScanner
+	if err := file.WriteContent(&scan); err != nil {
+		return err
+	}
+	fence := scan.fence()
+	if _, err := fmt.Fprintf(r.w, "## %s\n\n%s%s\n", file.Label(), fence, file.Language); err != nil {
+		return fmt.Errorf("failed to write start separator for %s: %w", file.RelPath, err)
+	}
+	if err := file.WriteContent(r.w); err != nil {
+		return err
+	}
+	closing := fence + "\n\n"
+	if scan.size > 0 && scan.last != '\n' {
+		closing = "\n" + closing
+	}
+	if _, err := io.WriteString(r.w, closing); err != nil {
+		return fmt.Errorf("failed to write end separator for %s: %w", file.RelPath, err)
+	}
+	return nil
+}
+
+func (r *markdownRenderer) SkipFile(file FileInfo, reason string) error {
+	r.skipped = append(r.skipped, SkippedRecord{Path: file.RelPath, Reason: reason})
+	return nil
+}
+
+func (r *markdownRenderer) EndDocument() error {
+	if len(r.skipped) == 0 {
+		return nil
+	}
+	var b strings.Builder
+	b.WriteString("## Skipped Files\n\n")
+	for _, s := range r.skipped {
+		fmt.Fprintf(&b, "- %s (%s)\n", s.Path, s.Reason)
+	}
+	if _, err := io.WriteString(r.w, b.String()); err != nil {
+		return fmt.Errorf("failed to write skipped files: %w", err)
+	}
+	return nil
+}
+
+// CodeFence returns a backtick fence long enough to enclose content: at least
+// three backticks, and one more than the longest backtick run in content.
+func CodeFence(content string) string {
+	var scan fenceScanner
+	io.WriteString(&scan, content)
+	return scan.fence()
+}
+
+// fenceScanner is CodeFence for content written to it in pieces. It also
+// notes the content's size and last byte.
+type fenceScanner struct {
+	longest, run int
+	size         int64
+	last         byte
+}
+
+func (s *fenceScanner) Write(p []byte) (int, error) {
+	for _, c := range p {
+		if c == '`' {
+			s.run++
+			s.longest = max(s.longest, s.run)
+		} else {
+			s.run = 0
+		}
+	}
+	if len(p) > 0 {
+		s.size += int64(len(p))
+		s.last = p[len(p)-1]
+	}
+	return len(p), nil
+}
+
+func (s *fenceScanner) fence() string {
+	if s.longest < 3 {
+		return "```"
+	}
+	return strings.Repeat("`", s.longest+1)
+}
@@ -0,0 +1,70 @@
+package utils
+
+import "runtime"
+
+// loadedFile is the outcome of loading one file for rendering.
+type loadedFile struct {
+	info       FileInfo
+	file       RenderFile
+	skipReason string // Non-empty if the file is to be reported via SkipFile
+}
+
+// loadOptions controls how files are loaded for rendering.
+type loadOptions struct {
+	SkipBinary  bool           // Report binary files as skipped
+	MaxFileSize int64          // Cut file content off after this many bytes; 0 for no limit
+	Jobs        int            // Number of files read in parallel; 0 for one per CPU
+	Secrets     *SecretScanner // Scans loaded files for secrets, if set
+	Transform   *Transformer   // Rewrites loaded files before they are scanned, if set
+	LineNumbers bool           // Prefix every line of loaded files with its number
+}
+
+// loadRenderFiles loads files with up to opts.Jobs workers (one per CPU if
+// 0) and calls fn for each of them in the order of files, so output stays
+// sorted. Only a window of about 2*jobs files is held in memory at a time:
+// workers wait while fn catches up. Directories and symlinks are passed
+// over. An error from fn stops the pipeline and is returned.
+func loadRenderFiles(files []FileInfo, opts loadOptions, fn func(loadedFile) error) error {
+	jobs := opts.Jobs
+	if jobs < 1 {
+		jobs = runtime.NumCPU()
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+
+	// One result channel per file, queued in order
+	pending := make(chan chan loadedFile, jobs)
+	go func() {
+		defer close(pending)
+		workers := make(chan struct{}, jobs)
+		for _, fileInfo := range files {
+			if fileInfo.IsDir || fileInfo.IsSymlink {
+				continue
+			}
+			result := make(chan loadedFile, 1)
+			select {
+			case pending <- result:
+			case <-done:
+				return
+			}
+			select {
+			case workers <- struct{}{}:
+			case <-done:
+				return
+			}
+			go func(fileInfo FileInfo) {
+				defer func() { <-workers }()
+				file, skipReason := loadRenderFile(fileInfo, opts)
+				result <- loadedFile{info: fileInfo, file: file, skipReason: skipReason}
+			}(fileInfo)
+		}
+	}()
+
+	for result := range pending {
+		if err := fn(<-result); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -6,42 +6,43 @@ import (
 	"io/fs"
 	"os"
 	"os/exec"
+	"path"
 	"path/filepath"
 	"sort"
 	"strings"
 
+	"github.com/bmatcuk/doublestar/v4"
 	"github.com/gobwas/glob"
-	gitignore "github.com/sabhiram/go-gitignore"
 )
 
 // GetProjectFiles lists files in a project directory.
 // rootDir: The root directory of the project.
 // customIgnorePatterns: Glob patterns for files/dirs to ignore.
+// includePatterns: If non-empty, only files matching one of these doublestar patterns (or below a matching directory) are kept.
 // respectGitIgnore: Whether to respect .gitignore rules.
 // specificFileArgs: If non-empty, these are specific files/globs to process (used by 'files' command).
 // includeDirsInResult: Whether to include directories in the returned list (useful for tree building).
+// allowSensitive: Whether to keep files on the sensitive-file deny-list (see isSensitiveFile); withheld files are reported.
 func GetProjectFiles(
-	rootDir string, customIgnorePatterns []string, respectGitIgnore bool,
-	specificFileArgs []string, includeDirsInResult bool) ([]FileInfo, error) {
+	rootDir string, customIgnorePatterns []string, includePatterns []string, respectGitIgnore bool,
+	specificFileArgs []string, includeDirsInResult bool, allowSensitive bool) ([]FileInfo, error) {
 
 	absRootDir, err := filepath.Abs(rootDir)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get absolute path for rootDir %s: %w", rootDir, err)
 	}
 
-	var gitIgnoreMatcher *gitignore.GitIgnore
+	// Nested .gitignore files, .git/info/exclude and core.excludesFile, so
+	// the filesystem walk sees the same files as 'git ls-files'
+	var gitIgnoreMatcher *IgnoreMatcher
 	if respectGitIgnore {
-		gitIgnoreFilePath := filepath.Join(absRootDir, ".gitignore")
-		if _, err := os.Stat(gitIgnoreFilePath); err == nil {
-			compiledMatcher, compileErr := gitignore.CompileIgnoreFile(gitIgnoreFilePath)
-			if compileErr != nil {
-				fmt.Fprintf(os.Stderr, "Warning: could not compile .gitignore at %s: %v\n", gitIgnoreFilePath, compileErr)
-			} else {
-				gitIgnoreMatcher = compiledMatcher
-			}
-		}
+		gitIgnoreMatcher = NewGitIgnoreMatcher(absRootDir)
 	}
 
+	// Project-local rules for what belongs in the context
+	comoIgnoreMatcher := NewComoIgnoreMatcher(absRootDir)
+	comoIncludeMatcher := NewComoIncludeMatcher(absRootDir)
+
 	customMatchers := make([]glob.Glob, 0, len(customIgnorePatterns))
 	for _, pattern := range customIgnorePatterns {
 		g, err := glob.Compile(pattern)
@@ -50,178 +51,330 @@ func GetProjectFiles(
 		}
 		customMatchers = append(customMatchers, g)
 	}
+	if err := validateIncludePatterns(includePatterns); err != nil {
+		return nil, err
+	}
 
 	candidateFiles := make(map[string]FileInfo)
 
 	if len(specificFileArgs) > 0 {
-		for _, arg := range specificFileArgs {
+		selector, outside, err := newFileArgSelector(absRootDir, specificFileArgs)
+		if err != nil {
+			return nil, err
+		}
+
+		// Arguments naming paths outside the project directory are expanded as they are
+		for _, arg := range outside {
 			patternToGlob := arg
 			if !filepath.IsAbs(arg) {
 				patternToGlob = filepath.Join(absRootDir, arg)
 			}
-
 			matches, err := filepath.Glob(patternToGlob)
 			if err != nil {
 				return nil, fmt.Errorf("error expanding glob pattern %s: %w", arg, err)
 			}
 			for _, matchPath := range matches {
-				absMatchPath, err := filepath.Abs(matchPath)
-				if err != nil {
-					fmt.Fprintf(os.Stderr, "Warning: could not get absolute path for %s: %v\n", matchPath, err)
+				fi, ok := statCandidate(absRootDir, matchPath)
+				if ok {
+					fi.Explicit = !hasGlobMeta(arg)
+					candidateFiles[fi.AbsPath] = fi
+				}
+			}
+		}
+
+		if literal, ok := selector.literalFiles(absRootDir); ok {
+			// Only plain file names: no need to list the whole project
+			for _, slashPath := range literal {
+				fi, ok := statCandidate(absRootDir, filepath.Join(absRootDir, filepath.FromSlash(slashPath)))
+				if selected, explicit := selector.selects(slashPath); ok && selected {
+					fi.Explicit = explicit
+					candidateFiles[fi.AbsPath] = fi
+				}
+			}
+		} else {
+			// Globs and directories are matched against the project listing,
+			// so ignored files stay out of recursive matches
+			listed, err := listProjectFiles(absRootDir, gitIgnoreMatcher, comoIgnoreMatcher)
+			if err != nil {
+				return nil, err
+			}
+			for absPath, fi := range listed {
+				if selected, explicit := selector.selects(filepath.ToSlash(fi.RelPath)); selected {
+					fi.Explicit = explicit
+					candidateFiles[absPath] = fi
+				}
+			}
+		}
+	} else {
+		candidateFiles, err = listProjectFiles(absRootDir, gitIgnoreMatcher, comoIgnoreMatcher)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var result []FileInfo
+	var withheld []string
+	for _, fi := range candidateFiles {
+		pathForMatching := fi.RelPath
+
+		if gitIgnoreMatcher != nil {
+			if gitIgnoreMatcher.Ignored(fi.RelPath, fi.IsDir) {
+				continue
+			}
+		}
+
+		if comoIgnoreMatcher.Ignored(fi.RelPath, fi.IsDir) {
+			continue
+		}
+		// Directories are kept below if they hold an allowed file
+		if comoIncludeMatcher != nil && !fi.IsDir && !comoIncludeMatcher.Listed(fi.RelPath, false) {
+			continue
+		}
+
+		isCustomIgnored := false
+		for _, matcher := range customMatchers {
+			pathToTestWithGlob := filepath.ToSlash(pathForMatching)
+			if matcher.Match(pathToTestWithGlob) {
+				isCustomIgnored = true
+				break
+			}
+		}
+		if isCustomIgnored {
+			continue
+		}
+
+		// Include patterns are applied after all ignore rules
+		if len(includePatterns) > 0 && !fi.IsDir && !matchesIncludePatterns(includePatterns, filepath.ToSlash(fi.RelPath)) {
+			continue
+		}
+
+		if !allowSensitive && !fi.IsDir && isSensitiveFile(filepath.ToSlash(fi.RelPath)) {
+			withheld = append(withheld, fi.RelPath)
+			continue
+		}
+
+		if !fi.IsDir && namedByIncludePattern(includePatterns, filepath.ToSlash(fi.RelPath)) {
+			fi.Explicit = true
+		}
+		if !fi.IsDir || includeDirsInResult {
+			result = append(result, fi)
+		}
+	}
+
+	if (comoIncludeMatcher != nil || len(includePatterns) > 0) && includeDirsInResult {
+		result = pruneEmptyDirs(result)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].RelPath < result[j].RelPath
+	})
+	sort.Strings(withheld)
+	reportWithheld(withheld)
+
+	return result, nil
+}
+
+// listProjectFiles lists every file below absRootDir that is not ignored,
+// with 'git ls-files' in a Git repository and by walking the filesystem
+// otherwise. Results are keyed by absolute path.
+func listProjectFiles(absRootDir string, gitIgnoreMatcher, comoIgnoreMatcher *IgnoreMatcher) (map[string]FileInfo, error) {
+	candidateFiles := make(map[string]FileInfo)
+
+	useGitLsFiles := isGitRepo(absRootDir)
+	if useGitLsFiles {
+		Log.Debugf("listing files in %s with 'git ls-files'", absRootDir)
+		cmd := exec.Command("git", "ls-files", "-coz", "--exclude-standard", "--full-name", "--")
+		cmd.Dir = absRootDir
+
+		var stdout, stderr bytes.Buffer
+		cmd.Stdout = &stdout
+		cmd.Stderr = &stderr
+
+		if err := cmd.Run(); err != nil {
+			Log.Warnf("'git ls-files' failed in %s (falling back to filesystem walk): %v\nStderr: %s", absRootDir, err, stderr.String())
+			useGitLsFiles = false
+		} else {
+			repoRootCmd := exec.Command("git", "rev-parse", "--show-toplevel")
+			repoRootCmd.Dir = absRootDir
+			repoRootOutput, repoRootErr := repoRootCmd.Output()
+			var actualRepoRoot string
+			if repoRootErr == nil {
+				actualRepoRoot = strings.TrimSpace(string(repoRootOutput))
+			} else {
+				actualRepoRoot = absRootDir
+				Log.Warnf("could not determine git repo root for %s, assuming it is the project directory: %v", absRootDir, repoRootErr)
+			}
+
+			files := strings.Split(strings.TrimRight(stdout.String(), "\x00"), "\x00")
+			for _, pathInRepo := range files {
+				if pathInRepo == "" {
 					continue
 				}
-				relPath, err := filepath.Rel(absRootDir, absMatchPath)
+				absPath := filepath.Join(actualRepoRoot, pathInRepo)
+
+				if !strings.HasPrefix(absPath, absRootDir+string(filepath.Separator)) && absPath != absRootDir {
+					continue
+				}
+
+				relPathToProjectRoot, err := filepath.Rel(absRootDir, absPath)
 				if err != nil {
-					fmt.Fprintf(os.Stderr, "Warning: could not get relative path for %s (base: %s): %v\n", absMatchPath, absRootDir, err)
-					relPath = filepath.Base(absMatchPath)
+					Log.Warnf("could not make path %s relative to %s: %v", absPath, absRootDir, err)
+					continue
 				}
 
-				fileInfo, err := os.Lstat(absMatchPath)
+				fileInfo, err := os.Lstat(absPath)
 				if err != nil {
 					if os.IsNotExist(err) {
 						continue
 					}
-					fmt.Fprintf(os.Stderr, "Warning: could not stat file %s: %v\n", absMatchPath, err)
+					Log.Warnf("could not stat file from git ls-files %s: %v", absPath, err)
 					continue
 				}
 				isDir := fileInfo.IsDir()
 				isSymlink := fileInfo.Mode()&os.ModeSymlink != 0
-
-				candidateFiles[absMatchPath] = FileInfo{AbsPath: absMatchPath, RelPath: relPath, IsDir: isDir, IsSymlink: isSymlink}
+				candidateFiles[absPath] = FileInfo{AbsPath: absPath, RelPath: relPathToProjectRoot, IsDir: isDir, IsSymlink: isSymlink}
 			}
 		}
-	} else {
-		useGitLsFiles := isGitRepo(absRootDir)
-		if useGitLsFiles {
-			cmd := exec.Command("git", "ls-files", "-coz", "--exclude-standard", "--full-name", "--")
-			cmd.Dir = absRootDir
-
-			var stdout, stderr bytes.Buffer
-			cmd.Stdout = &stdout
-			cmd.Stderr = &stderr
-
-			if err := cmd.Run(); err != nil {
-				fmt.Fprintf(os.Stderr,
-					"Warning: 'git ls-files' failed in %s (falling back to filesystem walk): %v\nStderr: %s\n", absRootDir, err, stderr.String())
-				useGitLsFiles = false
-			} else {
-				repoRootCmd := exec.Command("git", "rev-parse", "--show-toplevel")
-				repoRootCmd.Dir = absRootDir
-				repoRootOutput, repoRootErr := repoRootCmd.Output()
-				var actualRepoRoot string
-				if repoRootErr == nil {
-					actualRepoRoot = strings.TrimSpace(string(repoRootOutput))
-				} else {
-					actualRepoRoot = absRootDir
-					fmt.Fprintf(os.Stderr, "Warning: could not determine git repo root for %s, assuming it is the project directory: %v\n", absRootDir, repoRootErr)
-				}
+	}
 
-				files := strings.Split(strings.TrimRight(stdout.String(), "\x00"), "\x00")
-				for _, pathInRepo := range files {
-					if pathInRepo == "" {
-						continue
-					}
-					absPath := filepath.Join(actualRepoRoot, pathInRepo)
+	if !useGitLsFiles {
+		Log.Debugf("listing files in %s by walking the filesystem", absRootDir)
+		err := filepath.WalkDir(absRootDir, func(path string, d fs.DirEntry, walkErr error) error {
+			if walkErr != nil {
+				Log.Warnf("error accessing path %s: %v", path, walkErr)
+				if d.IsDir() && path != absRootDir {
+					return filepath.SkipDir
+				}
+				return nil
+			}
 
-					if !strings.HasPrefix(absPath, absRootDir+string(filepath.Separator)) && absPath != absRootDir {
-						continue
-					}
+			relPath, Rerr := filepath.Rel(absRootDir, path)
+			if Rerr != nil {
+				Log.Warnf("could not get relative path for %s: %v", path, Rerr)
+				relPath = filepath.Base(path)
+			}
 
-					relPathToProjectRoot, err := filepath.Rel(absRootDir, absPath)
-					if err != nil {
-						fmt.Fprintf(os.Stderr, "Warning: could not make path %s relative to %s: %v\n", absPath, absRootDir, err)
-						continue
-					}
+			if path == absRootDir || relPath == "." {
+				return nil
+			}
 
-					fileInfo, err := os.Lstat(absPath)
-					if err != nil {
-						if os.IsNotExist(err) {
-							continue
-						}
-						fmt.Fprintf(os.Stderr, "Warning: could not stat file from git ls-files %s: %v\n", absPath, err)
-						continue
-					}
-					isDir := fileInfo.IsDir()
-					isSymlink := fileInfo.Mode()&os.ModeSymlink != 0
-					candidateFiles[absPath] = FileInfo{AbsPath: absPath, RelPath: relPathToProjectRoot, IsDir: isDir, IsSymlink: isSymlink}
-				}
+			if d.Name() == ".git" && d.IsDir() {
+				return filepath.SkipDir
 			}
-		}
 
-		if !useGitLsFiles {
-			err := filepath.WalkDir(absRootDir, func(path string, d fs.DirEntry, walkErr error) error {
-				if walkErr != nil {
-					fmt.Fprintf(os.Stderr, "Warning: error accessing path %s: %v\n", path, walkErr)
-					if d.IsDir() && path != absRootDir {
+			if gitIgnoreMatcher != nil {
+				if gitIgnoreMatcher.Ignored(relPath, d.IsDir()) {
+					if d.IsDir() {
 						return filepath.SkipDir
 					}
-					return nil
-				}
-
-				relPath, Rerr := filepath.Rel(absRootDir, path)
-				if Rerr != nil {
-					fmt.Fprintf(os.Stderr, "Warning: could not get relative path for %s: %v\n", path, Rerr)
-					relPath = filepath.Base(path)
-				}
-
-				if path == absRootDir || relPath == "." {
-					return nil
+					return nil // Skip ignored file
 				}
+			}
 
-				if d.Name() == ".git" && d.IsDir() {
+			if comoIgnoreMatcher.Ignored(relPath, d.IsDir()) {
+				if d.IsDir() {
 					return filepath.SkipDir
 				}
-
-				if gitIgnoreMatcher != nil {
-					if gitIgnoreMatcher.MatchesPath(relPath) {
-						if d.IsDir() {
-							return filepath.SkipDir
-						}
-						return nil // Skip ignored file
-					}
-				}
-
-				isDir := d.IsDir()
-				isSymlink := d.Type()&os.ModeSymlink != 0
-				candidateFiles[path] = FileInfo{AbsPath: path, RelPath: relPath, IsDir: isDir, IsSymlink: isSymlink}
 				return nil
-			})
-			if err != nil {
-				return nil, fmt.Errorf("error walking directory %s: %w", absRootDir, err)
 			}
+
+			isDir := d.IsDir()
+			isSymlink := d.Type()&os.ModeSymlink != 0
+			candidateFiles[path] = FileInfo{AbsPath: path, RelPath: relPath, IsDir: isDir, IsSymlink: isSymlink}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error walking directory %s: %w", absRootDir, err)
 		}
 	}
+	return candidateFiles, nil
+}
 
-	var result []FileInfo
-	for _, fi := range candidateFiles {
-		pathForMatching := fi.RelPath
+// statCandidate returns the FileInfo of absPath, relative to absRootDir, or
+// false if it cannot be read.
+func statCandidate(absRootDir, absPath string) (FileInfo, bool) {
+	absPath, err := filepath.Abs(absPath)
+	if err != nil {
+		Log.Warnf("could not get absolute path for %s: %v", absPath, err)
+		return FileInfo{}, false
+	}
+	relPath, err := filepath.Rel(absRootDir, absPath)
+	if err != nil {
+		Log.Warnf("could not get relative path for %s (base: %s): %v", absPath, absRootDir, err)
+		relPath = filepath.Base(absPath)
+	}
 
-		if gitIgnoreMatcher != nil {
-			if gitIgnoreMatcher.MatchesPath(fi.RelPath) {
-				continue
-			}
+	fileInfo, err := os.Lstat(absPath)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			Log.Warnf("could not stat file %s: %v", absPath, err)
 		}
+		return FileInfo{}, false
+	}
+	isSymlink := fileInfo.Mode()&os.ModeSymlink != 0
+	return FileInfo{AbsPath: absPath, RelPath: relPath, IsDir: fileInfo.IsDir(), IsSymlink: isSymlink}, true
+}
 
-		isCustomIgnored := false
-		for _, matcher := range customMatchers {
-			pathToTestWithGlob := filepath.ToSlash(pathForMatching)
-			if matcher.Match(pathToTestWithGlob) {
-				isCustomIgnored = true
-				break
-			}
-		}
-		if isCustomIgnored {
+// pruneEmptyDirs drops directory entries that contain none of the files
+// in the list.
+func pruneEmptyDirs(files []FileInfo) []FileInfo {
+	used := make(map[string]bool)
+	for _, fi := range files {
+		if fi.IsDir {
 			continue
 		}
+		for dir := filepath.Dir(fi.RelPath); dir != "." && !used[dir]; dir = filepath.Dir(dir) {
+			used[dir] = true
+		}
+	}
 
-		if !fi.IsDir || includeDirsInResult {
+	result := files[:0]
+	for _, fi := range files {
+		if !fi.IsDir || used[fi.RelPath] {
 			result = append(result, fi)
 		}
 	}
+	return result
+}
 
-	sort.Slice(result, func(i, j int) bool {
-		return result[i].RelPath < result[j].RelPath
-	})
+// validateIncludePatterns checks that every include pattern is a valid
+// doublestar pattern.
+func validateIncludePatterns(patterns []string) error {
+	for _, pattern := range patterns {
+		if !doublestar.ValidatePattern(pattern) {
+			return fmt.Errorf("invalid include pattern %s", pattern)
+		}
+	}
+	return nil
+}
 
-	return result, nil
+// matchesIncludePatterns reports whether slashPath, or one of its parent
+// directories, matches one of the doublestar patterns. "**" matches any
+// number of directories, so "services/**/*.go" also matches
+// "services/main.go", and "services" matches everything below it.
+func matchesIncludePatterns(patterns []string, slashPath string) bool {
+	for _, pattern := range patterns {
+		if matchesPathOrParent(strings.TrimSuffix(strings.TrimPrefix(pattern, "./"), "/"), slashPath) {
+			return true
+		}
+	}
+	return false
+}
+
+// namedByIncludePattern reports whether one of the include patterns names
+// slashPath literally, which ranks it with the files named on the command
+// line.
+func namedByIncludePattern(patterns []string, slashPath string) bool {
+	for _, pattern := range patterns {
+		if !hasGlobMeta(pattern) && path.Clean(strings.TrimPrefix(pattern, "./")) == slashPath {
+			return true
+		}
+	}
+	return false
+}
+
+// hasGlobMeta reports whether pattern contains glob metacharacters, i.e.
+// whether it names files by pattern rather than literally.
+func hasGlobMeta(pattern string) bool {
+	return strings.ContainsAny(pattern, "*?[{")
 }
@@ -0,0 +1,201 @@
+package utils
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// DocumentInfo describes the bundle a renderer is producing.
+type DocumentInfo struct {
+	ProjectName string // Base name of the project directory
+	ProjectDir  string // Absolute path to the project directory
+	Part        int    // 1-based part number when the output is split, else 0
+	TotalParts  int    // Number of parts when the output is split, else 0
+	Ref         string // Git ref the files were read from (--ref), else empty for the working tree
+	Header      string // Free text placed before the tree and files (--header), e.g. instructions
+}
+
+// RenderFile is a file handed to a renderer together with its content.
+type RenderFile struct {
+	FileInfo
+	Content  string         // File content (empty for binary and streamed files)
+	Stream   *ContentStream // Set instead of Content for large files, which are copied from disk
+	IsBinary bool           // True if the file was detected as binary
+	Language string         // Language inferred from name, extension or shebang
+
+	// Set when the content was cut off at the --max-file-size limit.
+	Truncated    bool
+	OriginalSize int64 // Size of the whole file
+
+	// Names of the transforms (--transform) that rewrote Content, if any.
+	Transforms []string
+
+	// Set when every line of Content starts with its number (--line-numbers).
+	LineNumbers bool
+
+	// Set when Content is only a slice of a file split across output parts.
+	LineStart  int // First line of the slice (1-based)
+	LineEnd    int // Last line of the slice
+	TotalLines int // Number of lines in the whole file
+}
+
+// IsPartial reports whether the file holds only a range of its lines.
+func (f RenderFile) IsPartial() bool {
+	return f.TotalLines > 0
+}
+
+// Label returns the file's path, followed by its line range if partial, its
+// original size if truncated, the transforms that rewrote it and whether
+// its lines are numbered.
+func (f RenderFile) Label() string {
+	label := f.RelPath
+	if f.IsPartial() {
+		label += fmt.Sprintf(" (lines %d-%d of %d)", f.LineStart, f.LineEnd, f.TotalLines)
+	}
+	if f.Truncated {
+		label += fmt.Sprintf(" (truncated from %d bytes)", f.OriginalSize)
+	}
+	if len(f.Transforms) > 0 {
+		label += fmt.Sprintf(" (transformed: %s)", strings.Join(f.Transforms, ", "))
+	}
+	if f.LineNumbers {
+		label += " (with line numbers)"
+	}
+	return label
+}
+
+// Reasons passed to Renderer.SkipFile.
+const (
+	SkipReasonBinary    = "binary"
+	SkipReasonReadError = "read error"
+	SkipReasonBudget    = "exceeds token budget"
+	SkipReasonSecrets   = "contains secrets"
+)
+
+// Renderer turns a project listing into one output format. The pipeline
+// calls BeginDocument once, WriteTree at most once, WriteFile or SkipFile for
+// every listed file in order, and EndDocument last. Renderers list skipped
+// files in a trailer so readers know what was left out, except the text
+// renderer, which keeps its original layout; the pipeline reports skipped
+// files on stderr either way.
+type Renderer interface {
+	BeginDocument(doc DocumentInfo) error
+	WriteTree(tree string) error
+	WriteFile(file RenderFile) error
+	SkipFile(file FileInfo, reason string) error
+	EndDocument() error
+}
+
+// NewRenderer returns the renderer for a format as returned by ParseFormat.
+func NewRenderer(format string, w io.Writer) (Renderer, error) {
+	switch format {
+	case FormatText:
+		return &textRenderer{w: w}, nil
+	case FormatMarkdown:
+		return &markdownRenderer{w: w}, nil
+	case FormatXML:
+		return &xmlRenderer{w: w}, nil
+	case FormatJSON:
+		return &jsonRenderer{w: w}, nil
+	case FormatJSONL:
+		return &jsonlRenderer{w: w}, nil
+	default:
+		return nil, fmt.Errorf("no renderer for output format %q", format)
+	}
+}
+
+// RenderOptions controls how RenderProject feeds files to a renderer.
+type RenderOptions struct {
+	Tree        string         // Rendered project structure; empty to omit it
+	SkipBinary  bool           // Skip binary files instead of rendering them empty
+	Omitted     []FileInfo     // Files left out up front (e.g. by PackFiles), reported after the rendered ones
+	Jobs        int            // Number of files read in parallel; 0 for one per CPU
+	MaxFileSize int64          // Cut file content off after this many bytes; 0 for no limit
+	Secrets     *SecretScanner // Scans files for secrets before they are rendered, if set
+	Transform   *Transformer   // Rewrites file content before it is scanned and rendered, if set
+	LineNumbers bool           // Prefix every line of file content with its number; not meant to be combined with Transform
+}
+
+func (opts RenderOptions) loadOptions() loadOptions {
+	return loadOptions{SkipBinary: opts.SkipBinary, MaxFileSize: opts.MaxFileSize, Jobs: opts.Jobs, Secrets: opts.Secrets, Transform: opts.Transform, LineNumbers: opts.LineNumbers}
+}
+
+// RenderProject drives r over files: it begins the document, writes the tree,
+// reads every regular file and hands it to the renderer, then ends the
+// document. Files are read in parallel but handed over in order. Unreadable,
+// skipped binary and omitted files are reported via SkipFile.
+func RenderProject(r Renderer, doc DocumentInfo, files []FileInfo, opts RenderOptions) error {
+	if err := r.BeginDocument(doc); err != nil {
+		return err
+	}
+
+	if opts.Tree != "" {
+		if err := r.WriteTree(opts.Tree); err != nil {
+			return err
+		}
+	}
+
+	err := loadRenderFiles(files, opts.loadOptions(), func(loaded loadedFile) error {
+		if loaded.skipReason != "" {
+			return r.SkipFile(loaded.info, loaded.skipReason)
+		}
+		return r.WriteFile(loaded.file)
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, fileInfo := range opts.Omitted {
+		if err := r.SkipFile(fileInfo, SkipReasonBudget); err != nil {
+			return err
+		}
+	}
+
+	return r.EndDocument()
+}
+
+// loadRenderFile reads a file for rendering (see ReadRenderFile), transforms
+// it, scans it for secrets and numbers its lines. It returns a non-empty skip
+// reason, after logging it, if the file cannot or should not be rendered.
+func loadRenderFile(fileInfo FileInfo, opts loadOptions) (RenderFile, string) {
+	file, err := ReadRenderFile(fileInfo, opts.MaxFileSize)
+	if err != nil {
+		Log.Warnf("skipping file %s due to read error: %v", fileInfo.RelPath, err)
+		return RenderFile{}, SkipReasonReadError
+	}
+
+	if file.IsBinary && opts.SkipBinary {
+		Log.Verbosef("  Skipping binary file: %s", fileInfo.RelPath)
+		return RenderFile{}, SkipReasonBinary
+	}
+	if file.Truncated {
+		Log.Verbosef("  Truncating %s to %d of %d bytes", fileInfo.RelPath, file.ContentSize(), file.OriginalSize)
+	}
+	if err := opts.Transform.apply(&file); err != nil {
+		Log.Warnf("skipping file %s due to read error: %v", fileInfo.RelPath, err)
+		return RenderFile{}, SkipReasonReadError
+	}
+	if len(file.Transforms) > 0 {
+		Log.Verbosef("  Transforming %s (%s)", fileInfo.RelPath, strings.Join(file.Transforms, ", "))
+	}
+	reason, err := opts.Secrets.apply(&file)
+	if err != nil {
+		Log.Warnf("skipping file %s due to read error: %v", fileInfo.RelPath, err)
+		return RenderFile{}, SkipReasonReadError
+	}
+	if reason != "" {
+		Log.Verbosef("  Skipping file with secrets: %s", fileInfo.RelPath)
+		return RenderFile{}, reason
+	}
+	if opts.LineNumbers && !file.IsBinary {
+		content, err := file.FullContent()
+		if err != nil {
+			Log.Warnf("skipping file %s due to read error: %v", fileInfo.RelPath, err)
+			return RenderFile{}, SkipReasonReadError
+		}
+		file.Content, file.Stream = numberLines(content, 1), nil
+		file.LineNumbers = true
+	}
+	return file, ""
+}
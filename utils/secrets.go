@@ -0,0 +1,440 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Modes for --secrets.
+const (
+	SecretsRedact = "redact" // Replace each secret with a marker naming its rule
+	SecretsSkip   = "skip"   // Leave files holding secrets out of the bundle
+	SecretsFail   = "fail"   // Refuse to write a bundle that would hold secrets
+	SecretsOff    = "off"    // Do not scan
+)
+
+// SecretsModes lists the accepted --secrets values.
+var SecretsModes = []string{SecretsRedact, SecretsSkip, SecretsFail, SecretsOff}
+
+// customSecretRule names secrets found by patterns given with --secret-pattern.
+const customSecretRule = "custom"
+
+// redactionMarker matches the text a secret is replaced with, e.g.
+// "[REDACTED:aws-access-key]".
+var redactionMarker = regexp.MustCompile(`\[REDACTED:[a-z0-9-]+\]`)
+
+// secretRule is one kind of secret. If pattern has a capture group, only
+// the first group is the secret; the rest of the match is context.
+type secretRule struct {
+	name    string
+	pattern *regexp.Regexp
+	check   func(value string) bool // Optional test the secret must also pass
+}
+
+// builtinSecretRules are always applied. Keys with known prefixes come
+// first; the two entropy rules catch credentials without one.
+var builtinSecretRules = []secretRule{
+	{name: "private-key", pattern: regexp.MustCompile(`-----BEGIN (?:[A-Z0-9]+ )*PRIVATE KEY(?: BLOCK)?-----[\s\S]*?-----END (?:[A-Z0-9]+ )*PRIVATE KEY(?: BLOCK)?-----`)},
+	{name: "aws-access-key", pattern: regexp.MustCompile(`\b(?:AKIA|ASIA|ABIA|ACCA)[0-9A-Z]{16}\b`)},
+	{name: "aws-secret-key", pattern: regexp.MustCompile(`(?i)aws_?secret_?(?:access_?)?key["']?\s*(?::=|=>|=|:)\s*["']?([A-Za-z0-9/+]{40})`)},
+	{name: "github-token", pattern: regexp.MustCompile(`\b(?:gh[pousr]_[A-Za-z0-9]{36,255}|github_pat_[A-Za-z0-9_]{22,255})\b`)},
+	{name: "gitlab-token", pattern: regexp.MustCompile(`\bglpat-[A-Za-z0-9_-]{20,}`)},
+	{name: "slack-token", pattern: regexp.MustCompile(`\bxox[abposr]-[A-Za-z0-9-]{10,}`)},
+	{name: "stripe-key", pattern: regexp.MustCompile(`\b(?:sk|rk)_live_[A-Za-z0-9]{20,}`)},
+	{name: "google-api-key", pattern: regexp.MustCompile(`\bAIza[0-9A-Za-z_-]{35}`)},
+	{name: "api-key", pattern: regexp.MustCompile(`\bsk-(?:ant-|proj-)?[A-Za-z0-9_-]{20,}`), check: hasLetterAndDigit},
+	{name: "jwt", pattern: regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{10,}\.eyJ[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]{10,}`)},
+	{name: "url-password", pattern: regexp.MustCompile(`\b[A-Za-z][A-Za-z0-9+.-]*://[^\s:/@"']+:([^\s:/@"']+)@`), check: notPlaceholder},
+	{
+		// A value assigned to a name that suggests a credential
+		name:    "generic-secret",
+		pattern: regexp.MustCompile(`(?i)[\w.-]*?(?:secret|token|passw(?:or)?d|pwd|api[_-]?key|access[_-]?key|auth[_-]?key|private[_-]?key|credentials?)(?:[_-]?(?:key|value|string))?["']?\s*(?::=|=>|=|:)\s*["'` + "`" + `]?([^\s"'` + "`" + `,;(){}\[\]<>]{8,})`),
+		check: func(value string) bool {
+			return notPlaceholder(value) && !qualifiedName.MatchString(value) &&
+				hasLetterAndDigit(value) && shannonEntropy(value) >= 3.0
+		},
+	},
+	{
+		// A long random-looking string literal
+		name:    "high-entropy-string",
+		pattern: regexp.MustCompile(`["'` + "`" + `]([A-Za-z0-9+/=_-]{32,})["'` + "`" + `]`),
+		check: func(value string) bool {
+			return !isIntegrityHash(value) && !constantName.MatchString(value) && !hasAlphabetRun(value) &&
+				hasLetterAndDigit(value) && shannonEntropy(value) >= 4.3
+		},
+	},
+}
+
+// qualifiedName matches code such as cfg.Token assigned to a secret-like
+// name, and constantName identifiers such as TLS_ECDHE_RSA_WITH_AES_128.
+var (
+	qualifiedName = regexp.MustCompile(`^[A-Za-z_]\w*(?:\.[A-Za-z_]\w*)+$`)
+	constantName  = regexp.MustCompile(`^[A-Za-z0-9]+(?:_[A-Za-z0-9]+){2,}$`)
+)
+
+// SecretFinding is one secret found in a file.
+type SecretFinding struct {
+	Rule       string // Name of the rule that matched
+	Start, End int    // Byte range of the secret in the content
+	Line       int    // 1-based line the secret starts on
+}
+
+// SecretResult lists the secrets found in one file.
+type SecretResult struct {
+	Path     string
+	Findings []SecretFinding
+}
+
+// SecretScanner finds secrets in file content and handles them according
+// to its Mode. It records every file with findings for LogSummary and is
+// safe for concurrent use.
+type SecretScanner struct {
+	Mode  string
+	rules []secretRule
+
+	mu      sync.Mutex
+	results []SecretResult
+}
+
+// NewSecretScanner returns a scanner for mode with the built-in rules and a
+// rule for each of customPatterns (Go regular expressions).
+func NewSecretScanner(mode string, customPatterns []string) (*SecretScanner, error) {
+	valid := false
+	for _, m := range SecretsModes {
+		valid = valid || m == mode
+	}
+	if !valid {
+		return nil, fmt.Errorf("invalid --secrets value %q (supported: %s)", mode, strings.Join(SecretsModes, ", "))
+	}
+
+	s := &SecretScanner{Mode: mode, rules: builtinSecretRules}
+	for _, p := range customPatterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid secret pattern %q: %w", p, err)
+		}
+		s.rules = append(s.rules, secretRule{name: customSecretRule, pattern: re})
+	}
+	return s, nil
+}
+
+// active reports whether files are to be scanned.
+func (s *SecretScanner) active() bool {
+	return s != nil && s.Mode != SecretsOff
+}
+
+// Scan returns the secrets in content, ordered by position. Where matches
+// of several rules overlap, the one starting first wins.
+func (s *SecretScanner) Scan(content string) []SecretFinding {
+	var findings []SecretFinding
+	for _, rule := range s.rules {
+		for _, m := range rule.pattern.FindAllStringSubmatchIndex(content, -1) {
+			start, end := m[0], m[1]
+			if len(m) >= 4 && m[2] >= 0 {
+				start, end = m[2], m[3]
+			}
+			if start == end || (rule.check != nil && !rule.check(content[start:end])) {
+				continue
+			}
+			findings = append(findings, SecretFinding{Rule: rule.name, Start: start, End: end})
+		}
+	}
+	sort.SliceStable(findings, func(i, j int) bool {
+		if findings[i].Start != findings[j].Start {
+			return findings[i].Start < findings[j].Start
+		}
+		return findings[i].End > findings[j].End
+	})
+
+	kept := findings[:0]
+	line, lineAt := 1, 0
+	for _, f := range findings {
+		if len(kept) > 0 && f.Start < kept[len(kept)-1].End {
+			continue
+		}
+		line += strings.Count(content[lineAt:f.Start], "\n")
+		lineAt = f.Start
+		f.Line = line
+		kept = append(kept, f)
+	}
+	return kept
+}
+
+// scanStream scans a streamed file in windows of streamThreshold bytes. A
+// window overlaps the next by secretScanOverlap bytes, and matches starting
+// in the overlap are left to the next window, so a secret shorter than the
+// overlap is found whole.
+func (s *SecretScanner) scanStream(stream *ContentStream) ([]SecretFinding, error) {
+	const secretScanOverlap = 64 << 10
+
+	rc, err := stream.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	var findings []SecretFinding
+	buf := make([]byte, 0, streamThreshold)
+	offset, line, foundUpTo := 0, 1, 0 // Offset and line of buf[0], end of the last finding
+	for {
+		n, err := io.ReadFull(rc, buf[len(buf):cap(buf)])
+		buf = buf[:len(buf)+n]
+		last := err == io.EOF || err == io.ErrUnexpectedEOF
+		if err != nil && !last {
+			return nil, fmt.Errorf("failed to scan file %s: %w", stream.path, err)
+		}
+
+		limit := len(buf)
+		if !last {
+			limit -= secretScanOverlap
+		}
+		for _, f := range s.Scan(string(buf)) {
+			if f.Start >= limit || offset+f.Start < foundUpTo {
+				continue
+			}
+			f.Start, f.End, f.Line = offset+f.Start, offset+f.End, line+f.Line-1
+			findings = append(findings, f)
+			foundUpTo = f.End
+		}
+		if last {
+			return findings, nil
+		}
+
+		line += bytes.Count(buf[:limit], []byte("\n"))
+		offset += limit
+		buf = append(buf[:0], buf[limit:]...)
+	}
+}
+
+// Redact replaces the findings (as returned by Scan for content) with
+// markers naming their rules.
+func (s *SecretScanner) Redact(content string, findings []SecretFinding) string {
+	var b strings.Builder
+	pos := 0
+	for _, f := range findings {
+		b.WriteString(content[pos:f.Start])
+		b.WriteString(redactionText(f.Rule))
+		pos = f.End
+	}
+	b.WriteString(content[pos:])
+	return b.String()
+}
+
+func redactionText(rule string) string {
+	return "[REDACTED:" + rule + "]"
+}
+
+// Restore puts the secrets of original (the file on disk) back into
+// content, a redacted and possibly edited copy of it. It fails if the
+// markers in content do not line up with the secrets in original, e.g.
+// because an edit added, removed or reordered them. Content without
+// markers is returned as is.
+func (s *SecretScanner) Restore(content, original string) (string, bool) {
+	markers := redactionMarker.FindAllStringIndex(content, -1)
+	if len(markers) == 0 {
+		return content, true
+	}
+
+	// Redacting original yields one marker per secret, plus any marker
+	// text the file already held, which stands for itself.
+	type slot struct{ marker, text string }
+	var slots []slot
+	addLiteral := func(text string) {
+		for _, m := range redactionMarker.FindAllString(text, -1) {
+			slots = append(slots, slot{m, m})
+		}
+	}
+	pos := 0
+	for _, f := range s.Scan(original) {
+		addLiteral(original[pos:f.Start])
+		slots = append(slots, slot{redactionText(f.Rule), original[f.Start:f.End]})
+		pos = f.End
+	}
+	addLiteral(original[pos:])
+
+	if len(slots) != len(markers) {
+		return "", false
+	}
+	var b strings.Builder
+	pos = 0
+	for i, m := range markers {
+		if content[m[0]:m[1]] != slots[i].marker {
+			return "", false
+		}
+		b.WriteString(content[pos:m[0]])
+		b.WriteString(slots[i].text)
+		pos = m[1]
+	}
+	b.WriteString(content[pos:])
+	return b.String(), true
+}
+
+// apply scans a loaded file and handles its secrets according to the mode:
+// it redacts them in file, or returns SkipReasonSecrets for the file to be
+// skipped. In fail mode secrets are only recorded.
+func (s *SecretScanner) apply(file *RenderFile) (string, error) {
+	if !s.active() || file.IsBinary {
+		return "", nil
+	}
+
+	var findings []SecretFinding
+	if file.Stream != nil {
+		var err error
+		if findings, err = s.scanStream(file.Stream); err != nil {
+			return "", err
+		}
+	} else {
+		findings = s.Scan(file.Content)
+	}
+	if len(findings) == 0 {
+		return "", nil
+	}
+	s.record(file.RelPath, findings)
+
+	switch s.Mode {
+	case SecretsSkip:
+		return SkipReasonSecrets, nil
+	case SecretsRedact:
+		content, err := file.FullContent()
+		if err != nil {
+			return "", err
+		}
+		file.Content, file.Stream = s.Redact(content, findings), nil
+	}
+	return "", nil
+}
+
+func (s *SecretScanner) record(path string, findings []SecretFinding) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.results = append(s.results, SecretResult{Path: path, Findings: findings})
+}
+
+// withoutResults returns a scanner with the same mode and rules that keeps
+// its findings to itself, for passes that only look ahead at the files.
+func (s *SecretScanner) withoutResults() *SecretScanner {
+	if s == nil {
+		return nil
+	}
+	return &SecretScanner{Mode: s.Mode, rules: s.rules}
+}
+
+// Results returns the files in which secrets were found, sorted by path.
+func (s *SecretScanner) Results() []SecretResult {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	results := append([]SecretResult(nil), s.results...)
+	sort.Slice(results, func(i, j int) bool { return results[i].Path < results[j].Path })
+	return results
+}
+
+// LogSummary reports the secrets found so far as warnings: a count, then
+// each file with the rules and lines that matched.
+func (s *SecretScanner) LogSummary() {
+	results := s.Results()
+	if len(results) == 0 {
+		return
+	}
+
+	total := 0
+	for _, r := range results {
+		total += len(r.Findings)
+	}
+	action := map[string]string{
+		SecretsRedact: "redacted",
+		SecretsSkip:   "files skipped",
+		SecretsFail:   "nothing written",
+	}[s.Mode]
+	Log.Warnf("found %d secret(s) in %d file(s), %s:", total, len(results), action)
+	for _, r := range results {
+		found := make([]string, 0, len(r.Findings))
+		for _, f := range r.Findings {
+			found = append(found, fmt.Sprintf("%s (line %d)", f.Rule, f.Line))
+		}
+		Log.Warnf("  %s: %s", r.Path, strings.Join(found, ", "))
+	}
+}
+
+// CheckSecrets reads files as RenderProject would and returns an error if
+// any of them holds a secret. It lets --secrets fail stop a run before any
+// output is written.
+func CheckSecrets(files []FileInfo, opts RenderOptions) error {
+	err := loadRenderFiles(files, opts.loadOptions(), func(loadedFile) error { return nil })
+	if err != nil {
+		return err
+	}
+	return opts.Secrets.foundError()
+}
+
+// foundError returns the error that stops a --secrets fail run, or nil if
+// no secrets were found.
+func (s *SecretScanner) foundError() error {
+	if results := s.Results(); len(results) > 0 {
+		return fmt.Errorf("secrets found in %d file(s); use --secrets redact or skip, or --secrets off to include them", len(results))
+	}
+	return nil
+}
+
+// shannonEntropy returns the entropy of s in bits per byte.
+func shannonEntropy(s string) float64 {
+	var counts [256]int
+	for i := 0; i < len(s); i++ {
+		counts[s[i]]++
+	}
+	entropy := 0.0
+	for _, c := range counts {
+		if c > 0 {
+			p := float64(c) / float64(len(s))
+			entropy -= p * math.Log2(p)
+		}
+	}
+	return entropy
+}
+
+func hasLetterAndDigit(s string) bool {
+	return strings.ContainsAny(s, "0123456789") &&
+		strings.ContainsFunc(s, func(r rune) bool { return r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' })
+}
+
+// notPlaceholder reports whether value looks like a real value rather than
+// a reference such as ${VAR}, $VAR, %s or <token>.
+func notPlaceholder(value string) bool {
+	return !strings.ContainsAny(value[:1], "$%<{*") && !strings.Contains(value, "${")
+}
+
+// hasAlphabetRun reports whether s holds six or more consecutive characters
+// in order, as alphabet tables such as "ABCDEFGHIJKLMNOPQRSTUVWXYZ234567" do.
+func hasAlphabetRun(s string) bool {
+	run := 1
+	for i := 1; i < len(s); i++ {
+		if s[i] == s[i-1]+1 {
+			run++
+			if run >= 6 {
+				return true
+			}
+		} else {
+			run = 1
+		}
+	}
+	return false
+}
+
+// isIntegrityHash reports whether value is a Subresource Integrity hash, as
+// found in package-lock.json.
+func isIntegrityHash(value string) bool {
+	for _, prefix := range []string{"sha1-", "sha256-", "sha384-", "sha512-"} {
+		if strings.HasPrefix(value, prefix) {
+			return true
+		}
+	}
+	return false
+}
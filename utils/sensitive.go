@@ -0,0 +1,58 @@
+package utils
+
+import (
+	"strings"
+
+	"github.com/bmatcuk/doublestar/v4"
+)
+
+// sensitiveFilePatterns name files that usually hold credentials. They are
+// withheld from every listing unless --allow-sensitive is given, even when
+// nothing ignores them. Paths are matched in lower case.
+var sensitiveFilePatterns = []string{
+	// Private keys and keystores
+	"**/id_rsa", "**/id_dsa", "**/id_ecdsa", "**/id_ed25519",
+	"**/*.pem", "**/*.key", "**/*.p12", "**/*.pfx", "**/*.jks", "**/*.keystore", "**/*.ppk",
+	// Environment files
+	"**/.env", "**/.env.*", "**/*.env",
+	// Password databases and credential stores
+	"**/*.kdbx", "**/*.kdb", "**/.netrc", "**/.pgpass", "**/.htpasswd", "**/.git-credentials", "**/.pypirc",
+	"**/credentials.json", "**/.aws/credentials", "**/.docker/config.json",
+	// Infrastructure state with secrets in plain text
+	"**/*.tfstate", "**/*.tfstate.backup",
+}
+
+// sensitiveFileExceptions are templates matching sensitiveFilePatterns
+// that are meant to be shared.
+var sensitiveFileExceptions = []string{
+	"**/.env.example", "**/.env.sample", "**/.env.template", "**/.env.dist",
+}
+
+// isSensitiveFile reports whether the file at slashPath (relative to the
+// project root) is on the sensitive-file deny-list.
+func isSensitiveFile(slashPath string) bool {
+	lower := strings.ToLower(slashPath)
+	for _, pattern := range sensitiveFileExceptions {
+		if ok, _ := doublestar.Match(pattern, lower); ok {
+			return false
+		}
+	}
+	for _, pattern := range sensitiveFilePatterns {
+		if ok, _ := doublestar.Match(pattern, lower); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// reportWithheld warns about the sensitive files left out of a listing, so
+// their absence does not go unnoticed.
+func reportWithheld(relPaths []string) {
+	if len(relPaths) == 0 {
+		return
+	}
+	Log.Warnf("withheld %d sensitive file(s) (use --allow-sensitive to include them):", len(relPaths))
+	for _, relPath := range relPaths {
+		Log.Warnf("  %s", relPath)
+	}
+}
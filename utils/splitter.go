@@ -0,0 +1,464 @@
+package utils
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// splitUnitSlack covers separators (e.g. JSON commas) that a renderer adds
+// between files but that are not seen when a file is measured on its own.
+const splitUnitSlack = 4
+
+// RendererFactory creates a fresh renderer writing to w.
+type RendererFactory func(w io.Writer) (Renderer, error)
+
+// SplitOptions configures RenderSplitProject. Exactly one of MaxBytes and
+// MaxTokens should be set.
+type SplitOptions struct {
+	MaxBytes    int            // Maximum size of a part in bytes
+	MaxTokens   int            // Maximum size of a part in tokens, counted with Tokenizer
+	Tokenizer   Tokenizer      // Required when MaxTokens is set
+	Tree        string         // Rendered project structure, repeated in every part
+	SkipBinary  bool           // Skip binary files instead of rendering them empty
+	Omitted     []FileInfo     // Files left out up front, reported in the last part
+	Jobs        int            // Number of files read in parallel; 0 for one per CPU
+	MaxFileSize int64          // Cut file content off after this many bytes; 0 for no limit
+	Secrets     *SecretScanner // Scans files for secrets before they are rendered, if set
+	Transform   *Transformer   // Rewrites file content before it is scanned and rendered, if set
+	LineNumbers bool           // Prefix every line of file content with its number
+}
+
+// ParseByteSize parses sizes such as "100000", "100k" or "2m" (decimal
+// units: k = 1000 bytes, m = 1000k).
+func ParseByteSize(size string) (int, error) {
+	s := strings.ToLower(strings.TrimSpace(size))
+	s = strings.TrimSuffix(s, "b")
+	multiplier := 1
+	switch {
+	case strings.HasSuffix(s, "k"):
+		multiplier, s = 1000, strings.TrimSuffix(s, "k")
+	case strings.HasSuffix(s, "m"):
+		multiplier, s = 1000*1000, strings.TrimSuffix(s, "m")
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid size %q (expected e.g. 100000, 100k or 2m)", size)
+	}
+	return n * multiplier, nil
+}
+
+// PartPath returns the path of a numbered part, e.g. "context.part2.txt" for
+// "context.txt".
+func PartPath(outputPath string, part int) string {
+	ext := filepath.Ext(outputPath)
+	return fmt.Sprintf("%s.part%d%s", strings.TrimSuffix(outputPath, ext), part, ext)
+}
+
+// splitter measures rendered output to pack files into parts.
+type splitter struct {
+	newRenderer RendererFactory
+	doc         DocumentInfo
+	opts        SplitOptions
+
+	// A file whose line ranges run on into the next part, kept loaded so
+	// it is not read again for every part.
+	carried *RenderFile
+}
+
+// measure renders a document containing the given files and skipped files
+// and returns its size in bytes or tokens.
+func (s *splitter) measure(tree string, files []RenderFile, skipped []SkippedRecord) (int, error) {
+	// Measure with a two-digit part header so real headers never cost more.
+	doc := s.doc
+	doc.Part, doc.TotalParts = 99, 99
+	if s.opts.MaxTokens > 0 {
+		w := &tokenCountingWriter{tokenizer: s.opts.Tokenizer}
+		if err := renderDocument(s.newRenderer, doc, tree, files, skipped, w); err != nil {
+			return 0, err
+		}
+		return w.Count(), nil
+	}
+	var w byteCountingWriter
+	if err := renderDocument(s.newRenderer, doc, tree, files, skipped, &w); err != nil {
+		return 0, err
+	}
+	return int(w), nil
+}
+
+// renderDocument renders a whole document holding tree, files and skipped
+// files to w, to measure what they cost.
+func renderDocument(newRenderer RendererFactory, doc DocumentInfo, tree string, files []RenderFile, skipped []SkippedRecord, w io.Writer) error {
+	r, err := newRenderer(w)
+	if err != nil {
+		return err
+	}
+	if err := r.BeginDocument(doc); err != nil {
+		return err
+	}
+	if tree != "" {
+		if err := r.WriteTree(tree); err != nil {
+			return err
+		}
+	}
+	for _, f := range files {
+		if err := r.WriteFile(f); err != nil {
+			return err
+		}
+	}
+	for _, sk := range skipped {
+		if err := r.SkipFile(FileInfo{RelPath: sk.Path}, sk.Reason); err != nil {
+			return err
+		}
+	}
+	return r.EndDocument()
+}
+
+// byteCountingWriter counts the bytes written to it and discards them.
+type byteCountingWriter int64
+
+func (w *byteCountingWriter) Write(p []byte) (int, error) {
+	*w += byteCountingWriter(len(p))
+	return len(p), nil
+}
+
+func (s *splitter) limit() int {
+	if s.opts.MaxTokens > 0 {
+		return s.opts.MaxTokens
+	}
+	return s.opts.MaxBytes
+}
+
+// splitUnit is a file, or a range of its lines, placed into a part.
+type splitUnit struct {
+	info FileInfo
+	cost int // Size of the unit once rendered
+
+	// Set when the unit holds only a range of lines of the file, found at
+	// content[start:end] of the loaded file.
+	lineStart, lineEnd, totalLines int
+	start, end                     int
+}
+
+// RenderSplitProject renders files into numbered parts next to outputPath
+// (see PartPath), none larger than the configured size. Every part starts
+// with a "part N of M" header and repeats the tree. Files are kept whole
+// unless a single file is bigger than a part, in which case it is split into
+// line ranges. It returns the paths of the written parts.
+//
+// Files are read once to measure them and again while their part is
+// written, so only one part's worth of content is held in memory at a
+// time; a file bigger than a part is read whole to be split.
+func RenderSplitProject(newRenderer RendererFactory, doc DocumentInfo, files []FileInfo, outputPath string, opts SplitOptions) ([]string, error) {
+	s := &splitter{newRenderer: newRenderer, doc: doc, opts: opts}
+
+	// 1. Measure every file. Secrets found are recorded on this pass only.
+	var units []splitUnit
+	var skipped []SkippedRecord
+	empty, err := s.measure("", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	load := s.reloadOptions()
+	load.Secrets = opts.Secrets
+	err = loadRenderFiles(files, load, func(l loadedFile) error {
+		if l.skipReason != "" {
+			skipped = append(skipped, SkippedRecord{Path: l.info.RelPath, Reason: l.skipReason})
+			return nil
+		}
+		cost, err := s.measure("", []RenderFile{l.file}, nil)
+		if err != nil {
+			return err
+		}
+		units = append(units, splitUnit{info: l.info, cost: cost - empty + splitUnitSlack})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, fileInfo := range opts.Omitted {
+		skipped = append(skipped, SkippedRecord{Path: fileInfo.RelPath, Reason: SkipReasonBudget})
+	}
+
+	// 2. Work out how much room a part has for files
+	base, err := s.measure(opts.Tree, nil, skipped)
+	if err != nil {
+		return nil, err
+	}
+	capacity := s.limit() - base
+	if capacity <= 0 {
+		return nil, fmt.Errorf("split size %d is too small for the project structure and part header (%d)", s.limit(), base)
+	}
+
+	// 3. Pack files into parts in order, splitting oversized files by lines
+	var parts [][]splitUnit
+	var current []splitUnit
+	used := 0
+	for _, unit := range units {
+		pieces := []splitUnit{unit}
+		if unit.cost > capacity {
+			file, err := s.reload(unit.info)
+			if err != nil {
+				return nil, err
+			}
+			if pieces, err = s.splitFile(file, unit.cost, capacity, empty); err != nil {
+				return nil, err
+			}
+		}
+
+		for _, piece := range pieces {
+			if used+piece.cost > capacity && len(current) > 0 {
+				parts = append(parts, current)
+				current, used = nil, 0
+			}
+			current = append(current, piece)
+			used += piece.cost
+		}
+	}
+	if len(current) > 0 || len(parts) == 0 {
+		parts = append(parts, current)
+	}
+
+	// 4. Write the parts, reading their files again
+	var paths []string
+	for i, partUnits := range parts {
+		partDoc := doc
+		partDoc.Part, partDoc.TotalParts = i+1, len(parts)
+		path := PartPath(outputPath, i+1)
+
+		var partSkipped []SkippedRecord
+		if i == len(parts)-1 {
+			partSkipped = skipped
+		}
+		if err := s.writePart(path, partDoc, partUnits, partSkipped); err != nil {
+			return paths, err
+		}
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
+
+// reloadOptions returns how files are loaded after the first pass: like
+// on the first, but without recording secrets again.
+func (s *splitter) reloadOptions() loadOptions {
+	return loadOptions{
+		SkipBinary:  s.opts.SkipBinary,
+		MaxFileSize: s.opts.MaxFileSize,
+		Jobs:        s.opts.Jobs,
+		Secrets:     s.opts.Secrets.withoutResults(),
+		Transform:   s.opts.Transform,
+		LineNumbers: s.opts.LineNumbers,
+	}
+}
+
+// reload loads a file measured on the first pass again, with its content
+// in memory.
+func (s *splitter) reload(fileInfo FileInfo) (RenderFile, error) {
+	file, skipReason := loadRenderFile(fileInfo, s.reloadOptions())
+	if skipReason != "" {
+		return RenderFile{}, fmt.Errorf("%s changed while splitting: %s", fileInfo.RelPath, skipReason)
+	}
+	content, err := file.FullContent()
+	if err != nil {
+		return RenderFile{}, err
+	}
+	file.Content, file.Stream = content, nil
+	return file, nil
+}
+
+// cut returns the part of a reloaded file that the unit holds.
+func (u splitUnit) cut(file RenderFile) (RenderFile, error) {
+	if u.totalLines == 0 {
+		return file, nil
+	}
+	content, err := file.FullContent()
+	if err != nil {
+		return RenderFile{}, err
+	}
+	if len(content) < u.end {
+		return RenderFile{}, fmt.Errorf("%s changed while splitting", file.RelPath)
+	}
+	file.Content, file.Stream = content[u.start:u.end], nil
+	file.LineStart, file.LineEnd, file.TotalLines = u.lineStart, u.lineEnd, u.totalLines
+	return file, nil
+}
+
+// writePart renders one part to path, loading its files as it goes.
+func (s *splitter) writePart(path string, doc DocumentInfo, units []splitUnit, skipped []SkippedRecord) error {
+	writer, outFile, err := GetOutputWriter(path)
+	if err != nil {
+		return err
+	}
+	if outFile != nil {
+		defer outFile.Close()
+	}
+
+	r, err := s.newRenderer(writer)
+	if err != nil {
+		return err
+	}
+	if err := r.BeginDocument(doc); err != nil {
+		return err
+	}
+	if s.opts.Tree != "" {
+		if err := r.WriteTree(s.opts.Tree); err != nil {
+			return err
+		}
+	}
+
+	// Line ranges carried over from the previous part come first.
+	carried := s.carried
+	s.carried = nil
+	if carried != nil {
+		for len(units) > 0 && units[0].info.RelPath == carried.RelPath {
+			if err := s.writeUnit(r, units[0], *carried); err != nil {
+				return err
+			}
+			units = units[1:]
+		}
+	}
+
+	// Slices of a file follow each other, so each file is loaded once.
+	var infos []FileInfo
+	fileUnits := make(map[string][]splitUnit)
+	for _, u := range units {
+		if _, ok := fileUnits[u.info.RelPath]; !ok {
+			infos = append(infos, u.info)
+		}
+		fileUnits[u.info.RelPath] = append(fileUnits[u.info.RelPath], u)
+	}
+	err = loadRenderFiles(infos, s.reloadOptions(), func(l loadedFile) error {
+		if l.skipReason != "" {
+			return fmt.Errorf("%s changed while splitting: %s", l.info.RelPath, l.skipReason)
+		}
+		for _, u := range fileUnits[l.info.RelPath] {
+			if err := s.writeUnit(r, u, l.file); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, sk := range skipped {
+		if err := r.SkipFile(FileInfo{RelPath: sk.Path}, sk.Reason); err != nil {
+			return err
+		}
+	}
+	if err := r.EndDocument(); err != nil {
+		return err
+	}
+	if err := writer.Flush(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
+
+// writeUnit writes the part of a loaded file that u holds, and keeps the
+// file for the next part if its line ranges run on.
+func (s *splitter) writeUnit(r Renderer, u splitUnit, file RenderFile) error {
+	if u.totalLines > 0 && file.Stream != nil {
+		content, err := file.FullContent()
+		if err != nil {
+			return err
+		}
+		file.Content, file.Stream = content, nil
+	}
+	slice, err := u.cut(file)
+	if err != nil {
+		return err
+	}
+	if u.totalLines > 0 && u.end < len(file.Content) {
+		s.carried = &file
+	}
+	return r.WriteFile(slice)
+}
+
+// splitFile cuts a file that does not fit into a single part into slices of
+// whole lines that do, shrinking the slice size until every slice fits.
+// Lines longer than a slice are cut as well.
+func (s *splitter) splitFile(file RenderFile, cost, capacity, empty int) ([]splitUnit, error) {
+	lines := strings.SplitAfter(file.Content, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	// Start from the byte size the capacity corresponds to on average.
+	target := int(float64(len(file.Content)) * float64(capacity) / float64(cost) * 0.95)
+	for target > 0 {
+		units, ok, err := s.trySplit(file, lines, target, capacity, empty)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return units, nil
+		}
+		target = target * 4 / 5
+	}
+	return nil, fmt.Errorf("split size is too small to fit any part of %s", file.RelPath)
+}
+
+// trySplit slices lines into chunks of at most target bytes and reports
+// whether every chunk fits into capacity once rendered.
+func (s *splitter) trySplit(file RenderFile, lines []string, target, capacity, empty int) ([]splitUnit, bool, error) {
+	var units []splitUnit
+
+	chunkStart, pos := 0, 0 // Byte offsets into file.Content
+	start := 1
+	flush := func(end int) error {
+		unit := splitUnit{info: file.FileInfo, lineStart: start, lineEnd: end, totalLines: len(lines), start: chunkStart, end: pos}
+		slice, err := unit.cut(file)
+		if err != nil {
+			return err
+		}
+		cost, err := s.measure("", []RenderFile{slice}, nil)
+		if err != nil {
+			return err
+		}
+		unit.cost = cost - empty + splitUnitSlack
+		units = append(units, unit)
+		chunkStart = pos
+		return nil
+	}
+
+	for i, line := range lines {
+		lineNo := i + 1
+		if pos > chunkStart && pos-chunkStart+len(line) > target {
+			if err := flush(lineNo - 1); err != nil {
+				return nil, false, err
+			}
+			start = lineNo
+		}
+		// A single line longer than a chunk is cut into pieces.
+		for len(line) > target {
+			cut := target
+			for cut > 1 && !utf8.RuneStart(line[cut]) {
+				cut--
+			}
+			pos += cut
+			line = line[cut:]
+			if err := flush(lineNo); err != nil {
+				return nil, false, err
+			}
+			start = lineNo
+		}
+		pos += len(line)
+	}
+	if pos > chunkStart {
+		if err := flush(len(lines)); err != nil {
+			return nil, false, err
+		}
+	}
+
+	for _, u := range units {
+		if u.cost > capacity {
+			return nil, false, nil
+		}
+	}
+	return units, true, nil
+}
@@ -0,0 +1,215 @@
+package utils
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+// streamThreshold is the size above which a file on disk is not read into
+// memory: renderers copy it to the output from a ContentStream instead.
+const streamThreshold = 1 << 20
+
+// ContentStream is the content of a file too large to hold in memory.
+type ContentStream struct {
+	path string
+	Size int64 // Number of bytes Open yields (after truncation)
+}
+
+// Open opens the file for reading its first Size bytes.
+func (s *ContentStream) Open() (io.ReadCloser, error) {
+	f, err := os.Open(s.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file %s: %w", s.path, err)
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.LimitReader(f, s.Size), f}, nil
+}
+
+// copyTo copies the content to w.
+func (s *ContentStream) copyTo(w io.Writer) error {
+	rc, err := s.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	if _, err := io.Copy(w, rc); err != nil {
+		return fmt.Errorf("failed to copy file %s: %w", s.path, err)
+	}
+	return nil
+}
+
+// ContentSize returns the size of the file's (possibly truncated) content.
+func (f RenderFile) ContentSize() int64 {
+	if f.Stream != nil {
+		return f.Stream.Size
+	}
+	return int64(len(f.Content))
+}
+
+// FullContent returns the file's content, reading it into memory if it is
+// streamed. Renderers that need the whole content at once use it.
+func (f RenderFile) FullContent() (string, error) {
+	if f.Stream == nil {
+		return f.Content, nil
+	}
+	var b strings.Builder
+	b.Grow(int(f.Stream.Size))
+	if err := f.Stream.copyTo(&b); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// WriteContent writes the file's content to w, streaming it if needed.
+func (f RenderFile) WriteContent(w io.Writer) error {
+	if f.Stream != nil {
+		return f.Stream.copyTo(w)
+	}
+	if _, err := io.WriteString(w, f.Content); err != nil {
+		return fmt.Errorf("failed to write content for %s: %w", f.RelPath, err)
+	}
+	return nil
+}
+
+// cdataWriter writes content as a CDATA section as it arrives. Any "]]>"
+// inside the content is split across two sections so it cannot end the
+// block early, even when it spans two writes. Close ends the section.
+type cdataWriter struct {
+	w       io.Writer
+	started bool
+	pending []byte // Trailing "]" or "]]" that may start a "]]>" in the next write
+}
+
+func (c *cdataWriter) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if !c.started {
+		if _, err := io.WriteString(c.w, "<![CDATA["); err != nil {
+			return 0, err
+		}
+		c.started = true
+	}
+
+	data := p
+	if len(c.pending) > 0 {
+		data = append(c.pending, p...)
+	}
+	keep := 0
+	for keep < 2 && keep < len(data) && data[len(data)-1-keep] == ']' {
+		keep++
+	}
+	out := bytes.ReplaceAll(data[:len(data)-keep], []byte("]]>"), []byte("]]]]><![CDATA[>"))
+	c.pending = append([]byte(nil), data[len(data)-keep:]...)
+	if _, err := c.w.Write(out); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (c *cdataWriter) Close() error {
+	if !c.started {
+		return nil
+	}
+	_, err := c.w.Write(append(c.pending, "]]>"...))
+	return err
+}
+
+// jsonStringWriter writes content as the inside of a JSON string literal as
+// it arrives, escaping like encoding/json with HTML escaping off. Close
+// flushes an incomplete UTF-8 sequence left at the end.
+type jsonStringWriter struct {
+	w       io.Writer
+	pending []byte // Start of a UTF-8 sequence cut off by the previous write
+	buf     bytes.Buffer
+}
+
+const hexDigits = "0123456789abcdef"
+
+func (j *jsonStringWriter) Write(p []byte) (int, error) {
+	data := p
+	if len(j.pending) > 0 {
+		data = append(j.pending, p...)
+	}
+	j.pending = nil
+	j.buf.Reset()
+	for i := 0; i < len(data); {
+		c := data[i]
+		if c < utf8.RuneSelf {
+			switch {
+			case c >= 0x20 && c != '"' && c != '\\':
+				j.buf.WriteByte(c)
+			case c == '"' || c == '\\':
+				j.buf.WriteByte('\\')
+				j.buf.WriteByte(c)
+			case c == '\b':
+				j.buf.WriteString(`\b`)
+			case c == '\f':
+				j.buf.WriteString(`\f`)
+			case c == '\n':
+				j.buf.WriteString(`\n`)
+			case c == '\r':
+				j.buf.WriteString(`\r`)
+			case c == '\t':
+				j.buf.WriteString(`\t`)
+			default:
+				j.buf.WriteString(`\u00`)
+				j.buf.WriteByte(hexDigits[c>>4])
+				j.buf.WriteByte(hexDigits[c&0xF])
+			}
+			i++
+			continue
+		}
+		if !utf8.FullRune(data[i:]) {
+			j.pending = append([]byte(nil), data[i:]...)
+			break
+		}
+		r, size := utf8.DecodeRune(data[i:])
+		switch {
+		case r == utf8.RuneError && size == 1:
+			j.buf.WriteString(`\ufffd`)
+		case r == '\u2028' || r == '\u2029':
+			j.buf.WriteString(`\u202`)
+			j.buf.WriteByte(hexDigits[r&0xF])
+		default:
+			j.buf.Write(data[i : i+size])
+		}
+		i += size
+	}
+	if _, err := j.w.Write(j.buf.Bytes()); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (j *jsonStringWriter) Close() error {
+	if len(j.pending) == 0 {
+		return nil
+	}
+	_, err := io.WriteString(j.w, strings.Repeat(`\ufffd`, len(j.pending)))
+	j.pending = nil
+	return err
+}
+
+// hashStream returns the hex SHA-256 and size of streamed content.
+func hashStream(s *ContentStream) (string, int64, error) {
+	h := sha256.New()
+	rc, err := s.Open()
+	if err != nil {
+		return "", 0, err
+	}
+	defer rc.Close()
+	n, err := io.Copy(h, rc)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to hash file %s: %w", s.path, err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), n, nil
+}
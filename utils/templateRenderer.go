@@ -0,0 +1,111 @@
+package utils
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// TemplateData is the data model passed to user-defined output templates.
+type TemplateData struct {
+	ProjectName string          // Base name of the project directory
+	ProjectDir  string          // Absolute path to the project directory
+	Part        int             // 1-based part number when the output is split, else 0
+	TotalParts  int             // Number of parts when the output is split, else 0
+	Header      string          // Text given with --header, else empty
+	Tree        string          // Rendered project structure (empty for 'files')
+	Git         GitInfo         // Repository state of the project
+	Files       []TemplateFile  // Bundled files in path order
+	Skipped     []SkippedRecord // Listed files left out of the bundle
+}
+
+// TemplateFile describes one bundled file for templates.
+type TemplateFile struct {
+	RelPath  string // Path relative to the project root
+	Label    string // RelPath, plus the line range for a slice of a split file
+	Content  string // File content (empty for binary files)
+	Language string // Language inferred from name, extension or shebang
+	Size     int64  // Content size in bytes
+	Tokens   int    // Estimated token count of the content
+	IsBinary bool   // True if the file was detected as binary
+}
+
+// templateFuncs are the helper functions available to output templates.
+var templateFuncs = template.FuncMap{
+	"fence":      CodeFence,
+	"trimSuffix": strings.TrimSuffix,
+	"hasSuffix":  strings.HasSuffix,
+	"toSlash":    filepath.ToSlash,
+	"add":        func(a, b int) int { return a + b },
+}
+
+// templateRenderer collects the bundle and executes a text/template over it
+// when the document ends.
+type templateRenderer struct {
+	w    io.Writer
+	tmpl *template.Template
+	data TemplateData
+}
+
+// NewTemplateRenderer parses the template file at path and returns a renderer
+// that executes it with a TemplateData.
+func NewTemplateRenderer(path string, w io.Writer) (Renderer, error) {
+	tmpl, err := template.New(filepath.Base(path)).Funcs(templateFuncs).ParseFiles(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse template %s: %w", path, err)
+	}
+	return &templateRenderer{w: w, tmpl: tmpl}, nil
+}
+
+func (r *templateRenderer) BeginDocument(doc DocumentInfo) error {
+	r.data = TemplateData{
+		ProjectName: doc.ProjectName,
+		ProjectDir:  doc.ProjectDir,
+		Part:        doc.Part,
+		TotalParts:  doc.TotalParts,
+		Header:      doc.Header,
+	}
+	if doc.Ref != "" {
+		r.data.Git = GetGitRefInfo(doc.ProjectDir, doc.Ref)
+	} else {
+		r.data.Git = GetGitInfo(doc.ProjectDir)
+	}
+	return nil
+}
+
+func (r *templateRenderer) WriteTree(tree string) error {
+	r.data.Tree = tree
+	return nil
+}
+
+func (r *templateRenderer) WriteFile(file RenderFile) error {
+	// Templates see every file at once, so streamed content is read in
+	content, err := file.FullContent()
+	if err != nil {
+		return err
+	}
+	r.data.Files = append(r.data.Files, TemplateFile{
+		RelPath:  file.RelPath,
+		Label:    file.Label(),
+		Content:  content,
+		Language: file.Language,
+		Size:     int64(len(content)),
+		Tokens:   EstimateTokens(content),
+		IsBinary: file.IsBinary,
+	})
+	return nil
+}
+
+func (r *templateRenderer) SkipFile(file FileInfo, reason string) error {
+	r.data.Skipped = append(r.data.Skipped, SkippedRecord{Path: filepath.ToSlash(file.RelPath), Reason: reason})
+	return nil
+}
+
+func (r *templateRenderer) EndDocument() error {
+	if err := r.tmpl.Execute(r.w, r.data); err != nil {
+		return fmt.Errorf("failed to execute template %s: %w", r.tmpl.Name(), err)
+	}
+	return nil
+}
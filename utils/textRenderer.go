@@ -0,0 +1,65 @@
+package utils
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// textRenderer writes the original "--- START FILE: path ---" layout.
+type textRenderer struct {
+	w io.Writer
+}
+
+func (r *textRenderer) BeginDocument(doc DocumentInfo) error {
+	if doc.TotalParts > 0 {
+		if _, err := fmt.Fprintf(r.w, "--- PART %d OF %d: %s ---\n\n", doc.Part, doc.TotalParts, doc.ProjectName); err != nil {
+			return fmt.Errorf("failed to write part header: %w", err)
+		}
+	}
+	if doc.Header != "" {
+		if _, err := fmt.Fprintf(r.w, "--- HEADER ---\n%s\n--- END HEADER ---\n\n", strings.TrimRight(doc.Header, "\n")); err != nil {
+			return fmt.Errorf("failed to write header: %w", err)
+		}
+	}
+	return nil
+}
+
+func (r *textRenderer) WriteTree(tree string) error {
+	if _, err := io.WriteString(r.w, "--- START FILE: PROJECT STRUCTURE ---\n"); err != nil {
+		return fmt.Errorf("failed to write tree start marker: %w", err)
+	}
+	if _, err := io.WriteString(r.w, tree); err != nil {
+		return fmt.Errorf("failed to write tree content: %w", err)
+	}
+	if _, err := io.WriteString(r.w, "\n--- END FILE: PROJECT STRUCTURE ---\n\n"); err != nil {
+		return fmt.Errorf("failed to write tree end marker: %w", err)
+	}
+	return nil
+}
+
+func (r *textRenderer) WriteFile(file RenderFile) error {
+	separatorStart := fmt.Sprintf("--- START FILE: %s ---\n", file.Label())
+	separatorEnd := fmt.Sprintf("\n--- END FILE: %s ---\n\n", file.Label())
+
+	if _, err := io.WriteString(r.w, separatorStart); err != nil {
+		return fmt.Errorf("failed to write start separator for %s: %w", file.RelPath, err)
+	}
+	if err := file.WriteContent(r.w); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(r.w, separatorEnd); err != nil {
+		return fmt.Errorf("failed to write end separator for %s: %w", file.RelPath, err)
+	}
+	return nil
+}
+
+// SkipFile and EndDocument add nothing, which keeps the layout as it always
+// was. Skipped files are reported on stderr where they are skipped.
+func (r *textRenderer) SkipFile(file FileInfo, reason string) error {
+	return nil
+}
+
+func (r *textRenderer) EndDocument() error {
+	return nil
+}
@@ -0,0 +1,28 @@
+package utils
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestTextRendererKeepsLayout(t *testing.T) {
+	_, infos := writeTestProject(t, map[string]string{
+		"a.txt":   "a\n",
+		"bin.dat": "\x00\x01binary",
+		"b/c.go":  "package b",
+	})
+	var out bytes.Buffer
+
+	opts := RenderOptions{Tree: "project/\n└── a.txt", SkipBinary: true, Omitted: []FileInfo{{RelPath: "big.txt"}}}
+	if err := RenderProject(&textRenderer{w: &out}, DocumentInfo{ProjectName: "project"}, infos, opts); err != nil {
+		t.Fatal(err)
+	}
+
+	// The layout of the output before there were other formats
+	want := "--- START FILE: PROJECT STRUCTURE ---\nproject/\n└── a.txt\n--- END FILE: PROJECT STRUCTURE ---\n\n" +
+		"--- START FILE: a.txt ---\na\n\n--- END FILE: a.txt ---\n\n" +
+		"--- START FILE: b/c.go ---\npackage b\n--- END FILE: b/c.go ---\n\n"
+	if got := out.String(); got != want {
+		t.Errorf("output:\n%q\nwant:\n%q", got, want)
+	}
+}
@@ -0,0 +1,218 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/pkoukk/tiktoken-go"
+	tiktoken_loader "github.com/pkoukk/tiktoken-go-loader"
+)
+
+// Token encodings accepted by NewTokenizer.
+const (
+	EncodingCL100K = "cl100k_base" // GPT-4 / GPT-3.5 BPE ranks
+	EncodingO200K  = "o200k_base"  // GPT-4o BPE ranks
+	EncodingApprox = "approx"      // Four characters per token, no BPE
+)
+
+// Tokenizer counts the tokens in a piece of text.
+type Tokenizer interface {
+	Name() string
+	Count(text string) int
+}
+
+// EstimateTokens returns a rough token count for content using the common
+// heuristic of about four characters per token.
+func EstimateTokens(content string) int {
+	return (len(content) + 3) / 4
+}
+
+// approxTokenizer is the cheap chars/4 fallback.
+type approxTokenizer struct{}
+
+func (approxTokenizer) Name() string          { return EncodingApprox }
+func (approxTokenizer) Count(text string) int { return EstimateTokens(text) }
+
+// bpeTokenizer counts tokens with BPE ranks bundled in the binary.
+type bpeTokenizer struct {
+	name string
+	enc  *tiktoken.Tiktoken
+}
+
+func (t *bpeTokenizer) Name() string { return t.name }
+
+func (t *bpeTokenizer) Count(text string) int {
+	return len(t.enc.EncodeOrdinary(text))
+}
+
+var setOfflineLoader sync.Once
+
+// NewTokenizer returns a tokenizer for the named encoding. The BPE ranks are
+// embedded, so no network access is needed. If they cannot be loaded the
+// chars/4 approximation is returned together with a warning.
+func NewTokenizer(encoding string) (Tokenizer, error) {
+	switch encoding {
+	case "", EncodingCL100K, EncodingO200K:
+	case EncodingApprox:
+		return approxTokenizer{}, nil
+	default:
+		return nil, fmt.Errorf("unknown token encoding %q (supported: %s, %s, %s)", encoding, EncodingCL100K, EncodingO200K, EncodingApprox)
+	}
+	if encoding == "" {
+		encoding = EncodingCL100K
+	}
+
+	setOfflineLoader.Do(func() {
+		tiktoken.SetBpeLoader(tiktoken_loader.NewOfflineLoader())
+	})
+	enc, err := tiktoken.GetEncoding(encoding)
+	if err != nil {
+		Log.Warnf("could not load %s token ranks, falling back to a chars/4 estimate: %v", encoding, err)
+		return approxTokenizer{}, nil
+	}
+	return &bpeTokenizer{name: encoding, enc: enc}, nil
+}
+
+// FileTokenCount is the token count of a single bundled file.
+type FileTokenCount struct {
+	RelPath string
+	Bytes   int64
+	Tokens  int
+}
+
+// TokenReport summarizes the token counts of a bundle.
+type TokenReport struct {
+	Encoding   string
+	TreeTokens int
+	Files      []FileTokenCount
+}
+
+// Total returns the token count of the tree plus all files.
+func (r *TokenReport) Total() int {
+	total := r.TreeTokens
+	for _, f := range r.Files {
+		total += f.Tokens
+	}
+	return total
+}
+
+// SortByTokens orders the files by descending token count.
+func (r *TokenReport) SortByTokens() {
+	sort.SliceStable(r.Files, func(i, j int) bool {
+		return r.Files[i].Tokens > r.Files[j].Tokens
+	})
+}
+
+// Write prints the report as a table of token counts, sizes and paths.
+func (r *TokenReport) Write(w io.Writer) error {
+	if _, err := fmt.Fprintf(w, "Token counts (%s):\n", r.Encoding); err != nil {
+		return fmt.Errorf("failed to write token report: %w", err)
+	}
+	if r.TreeTokens > 0 {
+		fmt.Fprintf(w, "  %10d  %10s  %s\n", r.TreeTokens, "", "(project structure)")
+	}
+	for _, f := range r.Files {
+		fmt.Fprintf(w, "  %10d  %10d  %s\n", f.Tokens, f.Bytes, filepath.ToSlash(f.RelPath))
+	}
+	if _, err := fmt.Fprintf(w, "  %10d  %10s  total (%d files)\n", r.Total(), "", len(r.Files)); err != nil {
+		return fmt.Errorf("failed to write token report: %w", err)
+	}
+	return nil
+}
+
+// TokenCountingRenderer wraps another renderer and records the token count
+// of the tree and of every file passed through it.
+type TokenCountingRenderer struct {
+	next      Renderer
+	tokenizer Tokenizer
+	Report    TokenReport
+}
+
+// NewTokenCountingRenderer returns a renderer that counts tokens with
+// tokenizer before delegating to next.
+func NewTokenCountingRenderer(next Renderer, tokenizer Tokenizer) *TokenCountingRenderer {
+	return &TokenCountingRenderer{
+		next:      next,
+		tokenizer: tokenizer,
+		Report:    TokenReport{Encoding: tokenizer.Name()},
+	}
+}
+
+func (r *TokenCountingRenderer) BeginDocument(doc DocumentInfo) error {
+	return r.next.BeginDocument(doc)
+}
+
+func (r *TokenCountingRenderer) WriteTree(tree string) error {
+	r.Report.TreeTokens = r.tokenizer.Count(tree)
+	return r.next.WriteTree(tree)
+}
+
+// WriteFile counts streamed files chunk by chunk as they are read, so they
+// are not held in memory.
+func (r *TokenCountingRenderer) WriteFile(file RenderFile) error {
+	tokens := r.tokenizer.Count(file.Content)
+	if file.Stream != nil {
+		counter := &tokenCountingWriter{tokenizer: r.tokenizer}
+		if err := file.Stream.copyTo(counter); err != nil {
+			return err
+		}
+		tokens = counter.Count()
+	}
+	r.Report.Files = append(r.Report.Files, FileTokenCount{
+		RelPath: file.RelPath,
+		Bytes:   file.ContentSize(),
+		Tokens:  tokens,
+	})
+	return r.next.WriteFile(file)
+}
+
+func (r *TokenCountingRenderer) SkipFile(file FileInfo, reason string) error {
+	return r.next.SkipFile(file, reason)
+}
+
+func (r *TokenCountingRenderer) EndDocument() error {
+	return r.next.EndDocument()
+}
+
+// tokenCountChunk is how much text a tokenCountingWriter holds before
+// counting it.
+const tokenCountChunk = 64 << 10
+
+// tokenCountingWriter counts the tokens of everything written to it. Text is
+// counted in chunks cut at line breaks, so large output is never held in
+// memory at once.
+type tokenCountingWriter struct {
+	tokenizer Tokenizer
+	buf       []byte
+	tokens    int
+}
+
+func (w *tokenCountingWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	for len(w.buf) >= tokenCountChunk {
+		cut := bytes.LastIndexByte(w.buf[:tokenCountChunk], '\n') + 1
+		if cut == 0 {
+			cut = tokenCountChunk
+			for cut > 0 && !utf8.RuneStart(w.buf[cut]) {
+				cut--
+			}
+		}
+		w.tokens += w.tokenizer.Count(string(w.buf[:cut]))
+		w.buf = append(w.buf[:0], w.buf[cut:]...)
+	}
+	return len(p), nil
+}
+
+// Count returns the number of tokens written so far.
+func (w *tokenCountingWriter) Count() int {
+	if len(w.buf) > 0 {
+		w.tokens += w.tokenizer.Count(string(w.buf))
+		w.buf = w.buf[:0]
+	}
+	return w.tokens
+}
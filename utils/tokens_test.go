@@ -0,0 +1,52 @@
+package utils
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+// largestInputTokenizer counts like approxTokenizer and records the longest
+// text it was asked to count.
+type largestInputTokenizer struct {
+	largest int
+}
+
+func (*largestInputTokenizer) Name() string { return "test" }
+
+func (t *largestInputTokenizer) Count(text string) int {
+	t.largest = max(t.largest, len(text))
+	return EstimateTokens(text)
+}
+
+func TestTokenCountingRendererStreamsLargeFiles(t *testing.T) {
+	line := strings.Repeat("x", 99) + "\n"
+	content := strings.Repeat(line, 3*streamThreshold/len(line))
+	_, infos := writeTestProject(t, map[string]string{"big.txt": content, "small.txt": "small\n"})
+
+	tokenizer := &largestInputTokenizer{}
+	discard, err := NewRenderer(FormatText, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	counter := NewTokenCountingRenderer(discard, tokenizer)
+	if err := RenderProject(counter, DocumentInfo{}, infos, RenderOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []FileTokenCount{
+		{RelPath: "big.txt", Bytes: int64(len(content)), Tokens: EstimateTokens(content)},
+		{RelPath: "small.txt", Bytes: 6, Tokens: 2},
+	}
+	if len(counter.Report.Files) != len(want) {
+		t.Fatalf("report %+v, want %+v", counter.Report.Files, want)
+	}
+	for i, got := range counter.Report.Files {
+		if got != want[i] {
+			t.Errorf("file %d: %+v, want %+v", i, got, want[i])
+		}
+	}
+	if tokenizer.largest > tokenCountChunk {
+		t.Errorf("counted %d bytes at once, want at most %d", tokenizer.largest, tokenCountChunk)
+	}
+}
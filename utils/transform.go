@@ -0,0 +1,179 @@
+package utils
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Content transforms selected with --transform, in the order they are
+// applied.
+const (
+	TransformNone               = "none"
+	TransformGoSkeleton         = "go-skeleton"
+	TransformStripComments      = "strip-comments"
+	TransformCollapseBlankLines = "collapse-blank-lines"
+)
+
+// Transforms lists the supported --transform values.
+var Transforms = []string{TransformNone, TransformGoSkeleton, TransformStripComments, TransformCollapseBlankLines}
+
+// TransformOptions tunes a Transformer.
+type TransformOptions struct {
+	KeepExplicit bool // Leave files named literally on the command line as they are
+	KeepLicense  bool // Keep a leading license or copyright comment when stripping comments
+}
+
+// contentTransform rewrites the content of the files it applies to.
+type contentTransform struct {
+	appliesTo func(language string) bool
+	apply     func(content, language string, opts TransformOptions) (string, error)
+}
+
+var contentTransforms = map[string]contentTransform{
+	TransformGoSkeleton: {
+		appliesTo: func(language string) bool { return language == "go" },
+		apply: func(content, _ string, _ TransformOptions) (string, error) {
+			return goSkeleton(content)
+		},
+	},
+	TransformStripComments: {
+		appliesTo: hasCommentLexer,
+		apply: func(content, language string, opts TransformOptions) (string, error) {
+			return stripComments(content, language, opts.KeepLicense)
+		},
+	},
+	TransformCollapseBlankLines: {
+		appliesTo: func(string) bool { return true },
+		apply: func(content, _ string, _ TransformOptions) (string, error) {
+			return collapseBlankLines(content), nil
+		},
+	},
+}
+
+// Transformer rewrites file content before it is rendered, e.g. to cut Go
+// files down to their declarations. A nil *Transformer leaves files as they
+// are.
+type Transformer struct {
+	names []string
+	opts  TransformOptions
+}
+
+// NewTransformer returns a Transformer applying the named transforms, or
+// nil if names is empty or only "none". Transforms run in the order of
+// Transforms, whatever the order of names.
+func NewTransformer(names []string, opts TransformOptions) (*Transformer, error) {
+	t := &Transformer{opts: opts}
+	for _, name := range names {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" || name == TransformNone {
+			continue
+		}
+		if _, ok := contentTransforms[name]; !ok {
+			return nil, fmt.Errorf("invalid --transform value %q (supported: %s)", name, strings.Join(Transforms, ", "))
+		}
+		if !slices.Contains(t.names, name) {
+			t.names = append(t.names, name)
+		}
+	}
+	if len(t.names) == 0 {
+		return nil, nil
+	}
+	slices.SortFunc(t.names, func(a, b string) int {
+		return slices.Index(Transforms, a) - slices.Index(Transforms, b)
+	})
+	return t, nil
+}
+
+// Names returns the transforms in the order they are applied.
+func (t *Transformer) Names() []string {
+	if t == nil {
+		return nil
+	}
+	return t.names
+}
+
+// affects reports whether any transform applies to the file.
+func (t *Transformer) affects(fileInfo FileInfo, language string) bool {
+	if t == nil || (t.opts.KeepExplicit && fileInfo.Explicit) {
+		return false
+	}
+	for _, name := range t.names {
+		if contentTransforms[name].appliesTo(language) {
+			return true
+		}
+	}
+	return false
+}
+
+// Transform applies the transforms to the content of the file, written in
+// language (see DetectLanguage), and returns the result together with the
+// names of the transforms that changed it. A transform that fails, e.g. on
+// Go source that does not parse, is passed over with a warning.
+func (t *Transformer) Transform(fileInfo FileInfo, language, content string) (string, []string) {
+	if !t.affects(fileInfo, language) {
+		return content, nil
+	}
+	var applied []string
+	for _, name := range t.names {
+		tr := contentTransforms[name]
+		if !tr.appliesTo(language) {
+			continue
+		}
+		result, err := tr.apply(content, language, t.opts)
+		if err != nil {
+			Log.Warnf("could not apply %s to %s, keeping it as is: %v", name, fileInfo.RelPath, err)
+			continue
+		}
+		if result != content {
+			content = result
+			applied = append(applied, name)
+		}
+	}
+	return content, applied
+}
+
+// apply transforms a loaded file in place, reading streamed content into
+// memory first.
+func (t *Transformer) apply(file *RenderFile) error {
+	if file.IsBinary || !t.affects(file.FileInfo, file.Language) {
+		return nil
+	}
+	content, err := file.FullContent()
+	if err != nil {
+		return err
+	}
+	content, applied := t.Transform(file.FileInfo, file.Language, content)
+	if len(applied) > 0 {
+		file.Content, file.Stream = content, nil
+		file.Transforms = applied
+	}
+	return nil
+}
+
+// collapseBlankLines replaces every run of blank lines with a single empty
+// line and drops blank lines at the start and end of content.
+func collapseBlankLines(content string) string {
+	var b strings.Builder
+	b.Grow(len(content))
+	blank, wrote := false, false
+	for lineStart := 0; lineStart < len(content); {
+		lineEnd := nextLine(content, lineStart)
+		line := content[lineStart:lineEnd]
+		lineStart = lineEnd
+		if strings.TrimSpace(line) == "" {
+			blank = true
+			continue
+		}
+		if blank && wrote {
+			ending := lineEnding(line)
+			if ending == "" {
+				ending = "\n"
+			}
+			b.WriteString(ending)
+		}
+		b.WriteString(line)
+		blank, wrote = false, true
+	}
+	return b.String()
+}
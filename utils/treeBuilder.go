@@ -7,34 +7,55 @@ import (
 	"strings"
 )
 
-// tree structure (intenarl)
+// TreeNode is a file or directory in a FileTree.
 type TreeNode struct {
 	Name     string
 	IsDir    bool
 	Children map[string]*TreeNode
 }
 
-// BuildFileTree generates a string representation of the file tree.
+// SortedChildren returns the node's children ordered by name.
+func (n *TreeNode) SortedChildren() []*TreeNode {
+	children := make([]*TreeNode, 0, len(n.Children))
+	for _, child := range n.Children {
+		children = append(children, child)
+	}
+	sort.Slice(children, func(i, j int) bool {
+		return children[i].Name < children[j].Name
+	})
+	return children
+}
+
+// FileTree is the directory structure of a project listing.
+type FileTree struct {
+	Root *TreeNode // The project directory
+}
+
+// BuildFileTree lists the project (see GetProjectFiles) and returns its
+// file tree.
 func BuildFileTree(
-	rootDir string, customIgnorePatterns []string,
-	respectGitIgnore bool, specificFileArgs []string, includeDirsInResult bool) (string, error) {
+	rootDir string, customIgnorePatterns []string, includePatterns []string,
+	respectGitIgnore bool, specificFileArgs []string, includeDirsInResult bool, allowSensitive bool) (*FileTree, error) {
 
-	files, err := GetProjectFiles(rootDir, customIgnorePatterns, respectGitIgnore, specificFileArgs, includeDirsInResult)
+	files, err := GetProjectFiles(rootDir, customIgnorePatterns, includePatterns, respectGitIgnore, specificFileArgs, includeDirsInResult, allowSensitive)
 	if err != nil {
-		return "", fmt.Errorf("failed to get project files: %w", err)
+		return nil, fmt.Errorf("failed to get project files: %w", err)
 	}
 
-	if len(files) == 0 {
-		return "Project is empty or all files are ignored.", nil
-	}
+	return BuildFileTreeFromFiles(filepath.Base(rootDir), files), nil
+}
 
+// BuildFileTreeFromFiles arranges files (as listed by GetProjectFiles or
+// GetProjectFilesAtRef) into a tree under a root named rootName. Parent
+// directories missing from files are added; empty directories only appear
+// if they are listed.
+func BuildFileTreeFromFiles(rootName string, files []FileInfo) *FileTree {
 	root := &TreeNode{
-		Name:     filepath.Base(rootDir),
+		Name:     rootName,
 		IsDir:    true,
 		Children: make(map[string]*TreeNode),
 	}
 
-	// Build tree
 	for _, fi := range files {
 		parts := strings.Split(fi.RelPath, string(filepath.Separator))
 		curr := root
@@ -61,20 +82,27 @@ func BuildFileTree(
 		}
 	}
 
-	// Render tree
-	var b strings.Builder
-	b.WriteString(root.Name + "/\n")
+	return &FileTree{Root: root}
+}
 
-	var render func(node *TreeNode, prefix string, isLast bool)
-	render = func(node *TreeNode, prefix string, isLast bool) {
-		children := make([]*TreeNode, 0, len(node.Children))
-		for _, child := range node.Children {
-			children = append(children, child)
-		}
-		sort.Slice(children, func(i, j int) bool {
-			return children[i].Name < children[j].Name
-		})
+// IsEmpty reports whether the tree holds no files or directories.
+func (t *FileTree) IsEmpty() bool {
+	return len(t.Root.Children) == 0
+}
+
+// String draws the tree with box-drawing characters, children sorted by
+// name.
+func (t *FileTree) String() string {
+	if t.IsEmpty() {
+		return "Project is empty or all files are ignored."
+	}
+
+	var b strings.Builder
+	b.WriteString(t.Root.Name + "/\n")
 
+	var render func(node *TreeNode, prefix string)
+	render = func(node *TreeNode, prefix string) {
+		children := node.SortedChildren()
 		for i, child := range children {
 			connector := "├── "
 			nextPrefix := prefix + "│   "
@@ -89,11 +117,11 @@ func BuildFileTree(
 			b.WriteString("\n")
 
 			if len(child.Children) > 0 {
-				render(child, nextPrefix, i == len(children)-1)
+				render(child, nextPrefix)
 			}
 		}
 	}
 
-	render(root, "", true)
-	return b.String(), nil
+	render(t.Root, "")
+	return b.String()
 }
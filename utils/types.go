@@ -2,8 +2,21 @@ package utils
 
 // FileInfo holds path information for a file.
 type FileInfo struct {
-	AbsPath   string // Absolute path to the file
-	RelPath   string // Path relative to the project root
-	IsDir     bool   // True if it's a directory
-	IsSymlink bool   // True if it's a symlink
+	AbsPath   string   // Absolute path to the file
+	RelPath   string   // Path relative to the project root
+	IsDir     bool     // True if it's a directory
+	IsSymlink bool     // True if it's a symlink
+	Explicit  bool     // True if named literally (not via a glob) on the command line
+	Blob      *GitBlob // Set when the file is read from a Git commit (--ref) instead of disk
+}
+
+// WithoutDirs returns the entries of files that are not directories.
+func WithoutDirs(files []FileInfo) []FileInfo {
+	result := make([]FileInfo, 0, len(files))
+	for _, fi := range files {
+		if !fi.IsDir {
+			result = append(result, fi)
+		}
+	}
+	return result
 }
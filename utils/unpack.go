@@ -0,0 +1,305 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Actions planned by PlanUnpack.
+const (
+	UnpackCreate    = "create"
+	UnpackUpdate    = "update"
+	UnpackUnchanged = "unchanged"
+	UnpackConflict  = "conflict"
+	UnpackSkip      = "skip"
+)
+
+// UnpackChange is what unpacking one bundle file will do.
+type UnpackChange struct {
+	File    BundleFile
+	AbsPath string // Target path on disk
+	Action  string // One of the Unpack* actions
+	Reason  string // Why the file is skipped or conflicts
+	Old     string // Current content on disk, if the file exists
+	Exists  bool
+}
+
+// UnpackOptions configures PlanUnpack.
+type UnpackOptions struct {
+	// BaseHashes maps slash-separated paths to the SHA-256 of the content
+	// the bundle was made from (e.g. read from the original bundle).
+	BaseHashes map[string]string
+	// Force overwrites files that changed on disk since the bundle was made.
+	Force bool
+	// Secrets restores secrets redacted in the bundle from the files on
+	// disk (see SecretScanner.Restore), if set.
+	Secrets *SecretScanner
+	// StripLineNumbers removes line-number prefixes (see --line-numbers)
+	// from every file, also where the bundle does not mark them.
+	StripLineNumbers bool
+}
+
+// PlanUnpack works out what writing files under rootDir would do, without
+// touching the disk. It fails if any path is absolute or escapes rootDir.
+//
+// A file conflicts when its base hash is known (from the bundle itself or
+// opts.BaseHashes) and the file on disk no longer matches it.
+func PlanUnpack(rootDir string, files []BundleFile, opts UnpackOptions) ([]UnpackChange, error) {
+	// 1. Refuse the whole bundle if any path is unsafe
+	var unsafe []string
+	targets := make([]string, len(files))
+	for i, f := range files {
+		target, err := ResolveUnpackPath(rootDir, f.Path)
+		if err != nil {
+			unsafe = append(unsafe, err.Error())
+			continue
+		}
+		targets[i] = target
+	}
+	if len(unsafe) > 0 {
+		return nil, fmt.Errorf("refusing to unpack outside %s:\n  %s", rootDir, strings.Join(unsafe, "\n  "))
+	}
+
+	// 2. A later copy of a file replaces an earlier one
+	last := make(map[string]int)
+	for i := range files {
+		last[targets[i]] = i
+	}
+
+	var changes []UnpackChange
+	for i, f := range files {
+		change := UnpackChange{File: f, AbsPath: targets[i]}
+		switch {
+		case last[targets[i]] != i:
+			change.Action, change.Reason = UnpackSkip, "superseded by a later copy in the bundle"
+		case f.IsBinary:
+			change.Action, change.Reason = UnpackSkip, "binary file has no content in the bundle"
+		case f.TotalLines > 0:
+			change.Action = UnpackSkip
+			change.Reason = fmt.Sprintf("bundle holds only lines %d-%d of %d", f.LineStart, f.LineEnd, f.TotalLines)
+		case f.Truncated:
+			change.Action = UnpackSkip
+			change.Reason = fmt.Sprintf("bundle holds only the first %d of %d bytes", len(f.Content), f.OriginalSize)
+		case len(f.Transforms) > 0:
+			change.Action = UnpackSkip
+			change.Reason = fmt.Sprintf("bundle holds a rewritten copy (%s)", strings.Join(f.Transforms, ", "))
+		default:
+			if err := planFileChange(&change, opts); err != nil {
+				return nil, err
+			}
+		}
+		changes = append(changes, change)
+	}
+	return changes, nil
+}
+
+// planFileChange compares a bundle file with the file on disk.
+func planFileChange(change *UnpackChange, opts UnpackOptions) error {
+	f := change.File
+	newHash := hashContent(f.Content)
+
+	// A hash that matches the new content was recomputed after editing and
+	// says nothing about the original.
+	base := f.SHA256
+	if base == newHash {
+		base = ""
+	}
+	if b, ok := opts.BaseHashes[f.Path]; ok {
+		base = b
+	}
+
+	numbered := f.LineNumbers || opts.StripLineNumbers
+	if numbered {
+		f.Content = stripLineNumbers(f.Content)
+		change.File.Content = f.Content
+	}
+
+	info, err := os.Stat(change.AbsPath)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		change.Action = UnpackCreate
+		if base != "" && !opts.Force {
+			change.Action, change.Reason = UnpackConflict, "deleted since the bundle was made"
+		}
+		return nil
+	case err != nil:
+		return fmt.Errorf("failed to stat %s: %w", change.AbsPath, err)
+	case info.IsDir():
+		change.Action, change.Reason = UnpackSkip, "a directory exists at this path"
+		return nil
+	}
+
+	data, err := os.ReadFile(change.AbsPath)
+	if err != nil {
+		return fmt.Errorf("failed to read file %s: %w", change.AbsPath, err)
+	}
+	change.Old, change.Exists = string(data), true
+	if f.FinalNewlineUnknown && !strings.HasSuffix(change.Old, "\n") {
+		// Keep the file without a final newline, as on disk
+		f.Content = strings.TrimSuffix(f.Content, "\n")
+		change.File.Content = f.Content
+	}
+
+	if opts.Secrets != nil {
+		restored, ok := opts.Secrets.Restore(f.Content, change.Old)
+		if !ok {
+			change.Action, change.Reason = UnpackSkip, "redacted secrets do not match the file on disk"
+			return nil
+		}
+		f.Content, change.File.Content = restored, restored
+	}
+
+	switch {
+	case change.Old == f.Content:
+		change.Action = UnpackUnchanged
+	case base != "" && !matchesBaseHash(change.Old, base, opts.Secrets, numbered, f.FinalNewlineUnknown) && !opts.Force:
+		change.Action, change.Reason = UnpackConflict, "changed on disk since the bundle was made"
+	default:
+		change.Action = UnpackUpdate
+	}
+	return nil
+}
+
+// matchesBaseHash reports whether content is what a bundle with the base
+// hash was made from. Bundles made with --secrets redact hash the redacted
+// content, and those made with --line-numbers the numbered content. With
+// newlineUnknown, the base may have been taken with a final newline added.
+func matchesBaseHash(content, base string, secrets *SecretScanner, numbered, newlineUnknown bool) bool {
+	candidates := []string{content}
+	if secrets != nil {
+		candidates = append(candidates, secrets.Redact(content, secrets.Scan(content)))
+	}
+	if newlineUnknown && !strings.HasSuffix(content, "\n") {
+		for _, c := range candidates {
+			candidates = append(candidates, c+"\n")
+		}
+	}
+	for _, c := range candidates {
+		if hashContent(c) == base || numbered && hashContent(numberLines(c, 1)) == base {
+			return true
+		}
+	}
+	return false
+}
+
+// ResolveUnpackPath joins the bundle path rel onto rootDir, refusing
+// absolute paths, paths that leave rootDir, including through symlinks, and
+// paths inside a .git directory, where a hook or config could run code.
+func ResolveUnpackPath(rootDir, rel string) (string, error) {
+	if strings.TrimSpace(rel) == "" {
+		return "", fmt.Errorf("a file has an empty path")
+	}
+	native := filepath.FromSlash(rel)
+	if filepath.IsAbs(native) || strings.HasPrefix(rel, "/") || filepath.VolumeName(native) != "" {
+		return "", fmt.Errorf("%s: absolute path", rel)
+	}
+	clean := filepath.Clean(native)
+	if clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s: path leaves the project directory", rel)
+	}
+	for _, part := range strings.Split(clean, string(filepath.Separator)) {
+		if strings.EqualFold(part, ".git") {
+			return "", fmt.Errorf("%s: path is inside a .git directory", rel)
+		}
+	}
+	target := filepath.Join(rootDir, clean)
+
+	// Resolve the deepest existing ancestor so a symlinked directory cannot
+	// redirect the write elsewhere.
+	realRoot, err := filepath.EvalSymlinks(rootDir)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve project directory %s: %w", rootDir, err)
+	}
+	existing := target
+	for {
+		if _, err := os.Lstat(existing); err == nil {
+			break
+		}
+		existing = filepath.Dir(existing)
+	}
+	realExisting, err := filepath.EvalSymlinks(existing)
+	if err != nil {
+		return "", fmt.Errorf("%s: failed to resolve path: %w", rel, err)
+	}
+	if !isWithinDir(realRoot, realExisting) {
+		return "", fmt.Errorf("%s: path leaves the project directory through a symlink", rel)
+	}
+	return target, nil
+}
+
+// isWithinDir reports whether path is dir or inside it.
+func isWithinDir(dir, path string) bool {
+	relPath, err := filepath.Rel(dir, path)
+	if err != nil {
+		return false
+	}
+	return relPath == "." || (relPath != ".." && !strings.HasPrefix(relPath, ".."+string(filepath.Separator)))
+}
+
+// ApplyUnpack writes the created and updated files of changes. When
+// backupDir is set, files about to be overwritten are copied there first,
+// keeping their relative paths.
+func ApplyUnpack(rootDir string, changes []UnpackChange, backupDir string) error {
+	for _, change := range changes {
+		if change.Action != UnpackCreate && change.Action != UnpackUpdate {
+			continue
+		}
+
+		mode := fs.FileMode(0644)
+		if change.Exists {
+			if info, err := os.Stat(change.AbsPath); err == nil {
+				mode = info.Mode().Perm()
+			}
+			if backupDir != "" {
+				if err := backupFile(rootDir, change, backupDir, mode); err != nil {
+					return err
+				}
+			}
+		}
+
+		if err := os.MkdirAll(filepath.Dir(change.AbsPath), 0755); err != nil {
+			return fmt.Errorf("failed to create directory for %s: %w", change.File.Path, err)
+		}
+		if err := os.WriteFile(change.AbsPath, []byte(change.File.Content), mode); err != nil {
+			return fmt.Errorf("failed to write file %s: %w", change.AbsPath, err)
+		}
+	}
+	return nil
+}
+
+// backupFile copies the current content of a file into backupDir.
+func backupFile(rootDir string, change UnpackChange, backupDir string, mode fs.FileMode) error {
+	relPath, err := filepath.Rel(rootDir, change.AbsPath)
+	if err != nil {
+		return fmt.Errorf("failed to compute backup path for %s: %w", change.AbsPath, err)
+	}
+	backupPath := filepath.Join(backupDir, relPath)
+	if err := os.MkdirAll(filepath.Dir(backupPath), 0755); err != nil {
+		return fmt.Errorf("failed to create backup directory for %s: %w", relPath, err)
+	}
+	if err := os.WriteFile(backupPath, []byte(change.Old), mode); err != nil {
+		return fmt.Errorf("failed to back up %s: %w", relPath, err)
+	}
+	return nil
+}
+
+// BundleHashes returns the SHA-256 of every whole file in files, keyed by
+// path, for use as UnpackOptions.BaseHashes.
+func BundleHashes(files []BundleFile) map[string]string {
+	hashes := make(map[string]string)
+	for _, f := range files {
+		switch {
+		case f.TotalLines > 0:
+			continue
+		case f.IsBinary && f.SHA256 != "":
+			hashes[f.Path] = f.SHA256
+		case !f.IsBinary:
+			hashes[f.Path] = hashContent(f.Content)
+		}
+	}
+	return hashes
+}
@@ -0,0 +1,148 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestResolveUnpackPath(t *testing.T) {
+	root := t.TempDir()
+	outside := t.TempDir()
+	if err := os.Symlink(outside, filepath.Join(root, "link")); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+
+	tests := []struct {
+		rel     string
+		wantErr bool
+	}{
+		{"a/b.txt", false},
+		{"a/../b.txt", false},
+		{"./c.txt", false},
+		{"../x.txt", true},
+		{"..", true},
+		{"a/../../x.txt", true},
+		{"a/b/../../../x.txt", true},
+		{"/etc/passwd", true},
+		{"", true},
+		{"link/x.txt", true},
+		{"link/../x.txt", false},
+		{".git/hooks/pre-commit", true},
+		{".git/config", true},
+		{".GIT/config", true},
+		{"sub/.git/hooks/post-checkout", true},
+		{"a/../.git/config", true},
+		{".git", true},
+		{".gitignore", false},
+		{"a/.github/workflows/ci.yml", false},
+	}
+	for _, tt := range tests {
+		target, err := ResolveUnpackPath(root, tt.rel)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ResolveUnpackPath(%q) = %q, %v; want error %v", tt.rel, target, err, tt.wantErr)
+			continue
+		}
+		if err == nil && !isWithinDir(root, target) {
+			t.Errorf("ResolveUnpackPath(%q) = %q, outside %s", tt.rel, target, root)
+		}
+	}
+}
+
+func TestPlanUnpackRefusesGitDirectory(t *testing.T) {
+	root := t.TempDir()
+	files := []BundleFile{{Path: ".git/hooks/pre-commit", Content: "#!/bin/sh\n"}}
+	if _, err := PlanUnpack(root, files, UnpackOptions{}); err == nil || !strings.Contains(err.Error(), ".git") {
+		t.Fatalf("PlanUnpack = %v, want an error refusing the .git path", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, ".git")); !os.IsNotExist(err) {
+		t.Errorf(".git was created: %v", err)
+	}
+}
+
+func TestPlanUnpackRefusesEscapingBundle(t *testing.T) {
+	root := t.TempDir()
+	files := []BundleFile{
+		{Path: "ok.txt", Content: "fine\n"},
+		{Path: "../evil.txt", Content: "nope\n"},
+	}
+	if _, err := PlanUnpack(root, files, UnpackOptions{}); err == nil || !strings.Contains(err.Error(), "../evil.txt") {
+		t.Fatalf("PlanUnpack = %v, want an error naming ../evil.txt", err)
+	}
+}
+
+func TestPlanUnpackBaseHash(t *testing.T) {
+	const original = "one\ntwo\n"
+	tests := []struct {
+		name       string
+		onDisk     *string // nil if the file does not exist
+		bundled    string
+		recorded   string // Hash recorded in the bundle
+		base       string // Hash from --base, if any
+		force      bool
+		wantAction string
+	}{
+		{name: "edited in bundle", onDisk: ptr(original), bundled: "one\nTWO\n", recorded: hashContent(original), wantAction: UnpackUpdate},
+		{name: "unchanged", onDisk: ptr(original), bundled: original, recorded: hashContent(original), wantAction: UnpackUnchanged},
+		{name: "changed on disk", onDisk: ptr("one\nthree\n"), bundled: "one\nTWO\n", recorded: hashContent(original), wantAction: UnpackConflict},
+		{name: "changed on disk, forced", onDisk: ptr("one\nthree\n"), bundled: "one\nTWO\n", recorded: hashContent(original), force: true, wantAction: UnpackUpdate},
+		{name: "deleted on disk", bundled: "one\nTWO\n", recorded: hashContent(original), wantAction: UnpackConflict},
+		{name: "new file", bundled: "new\n", wantAction: UnpackCreate},
+		{name: "hash recomputed after editing", onDisk: ptr("one\nthree\n"), bundled: "one\nTWO\n", recorded: hashContent("one\nTWO\n"), wantAction: UnpackUpdate},
+		{name: "base from --base", onDisk: ptr("one\nthree\n"), bundled: "one\nTWO\n", base: hashContent(original), wantAction: UnpackConflict},
+		{name: "no base known", onDisk: ptr("one\nthree\n"), bundled: "one\nTWO\n", wantAction: UnpackUpdate},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			if tt.onDisk != nil {
+				if err := os.WriteFile(filepath.Join(root, "f.txt"), []byte(*tt.onDisk), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			opts := UnpackOptions{Force: tt.force}
+			if tt.base != "" {
+				opts.BaseHashes = map[string]string{"f.txt": tt.base}
+			}
+			changes, err := PlanUnpack(root, []BundleFile{{Path: "f.txt", Content: tt.bundled, SHA256: tt.recorded}}, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := changes[0].Action; got != tt.wantAction {
+				t.Errorf("action %s (%s), want %s", got, changes[0].Reason, tt.wantAction)
+			}
+		})
+	}
+}
+
+func TestPlanUnpackMarkdownFinalNewline(t *testing.T) {
+	root, infos := writeTestProject(t, map[string]string{"no-eol.txt": "last line"})
+	bundle := renderTestBundle(t, FormatMarkdown, infos, RenderOptions{})
+	files, _, err := ParseBundle(bundle, FormatMarkdown)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := UnpackOptions{BaseHashes: BundleHashes(files)}
+
+	changes, err := PlanUnpack(root, files, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changes[0].Action != UnpackUnchanged {
+		t.Errorf("unchanged bundle: action %s (%s), want %s", changes[0].Action, changes[0].Reason, UnpackUnchanged)
+	}
+
+	files[0].Content = "edited line\n"
+	changes, err = PlanUnpack(root, files, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changes[0].Action != UnpackUpdate || changes[0].File.Content != "edited line" {
+		t.Errorf("edited bundle: action %s, content %q; want %s of %q", changes[0].Action, changes[0].File.Content, UnpackUpdate, "edited line")
+	}
+}
+
+func ptr(s string) *string {
+	return &s
+}
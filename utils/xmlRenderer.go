@@ -0,0 +1,114 @@
+package utils
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// xmlRenderer writes the tree in <project_structure> and the files as
+// indexed <document> elements inside a <documents> block.
+type xmlRenderer struct {
+	w       io.Writer
+	index   int // Number of documents written so far
+	skipped []SkippedRecord
+}
+
+func (r *xmlRenderer) BeginDocument(doc DocumentInfo) error {
+	if doc.TotalParts > 0 {
+		if _, err := fmt.Fprintf(r.w, "<context_part number=\"%d\" total=\"%d\" project=\"%s\"/>\n\n", doc.Part, doc.TotalParts, escapeXMLAttr(doc.ProjectName)); err != nil {
+			return fmt.Errorf("failed to write part header: %w", err)
+		}
+	}
+	if doc.Header != "" {
+		if _, err := fmt.Fprintf(r.w, "<header>\n%s\n</header>\n\n", escapeXMLText(strings.TrimRight(doc.Header, "\n"))); err != nil {
+			return fmt.Errorf("failed to write header: %w", err)
+		}
+	}
+	return nil
+}
+
+func (r *xmlRenderer) WriteTree(tree string) error {
+	if _, err := fmt.Fprintf(r.w, "<project_structure>\n%s\n</project_structure>\n\n", escapeXMLText(strings.TrimRight(tree, "\n"))); err != nil {
+		return fmt.Errorf("failed to write tree content: %w", err)
+	}
+	return nil
+}
+
+func (r *xmlRenderer) WriteFile(file RenderFile) error {
+	if r.index == 0 {
+		if _, err := io.WriteString(r.w, "<documents>\n"); err != nil {
+			return fmt.Errorf("failed to write documents start tag: %w", err)
+		}
+	}
+	r.index++
+
+	attrs := fmt.Sprintf(" index=\"%d\"", r.index)
+	if file.IsPartial() {
+		attrs += fmt.Sprintf(" lines=\"%d-%d\" total_lines=\"%d\"", file.LineStart, file.LineEnd, file.TotalLines)
+	}
+	if file.Truncated {
+		attrs += fmt.Sprintf(" truncated_from=\"%d\"", file.OriginalSize)
+	}
+	if len(file.Transforms) > 0 {
+		attrs += fmt.Sprintf(" transforms=\"%s\"", strings.Join(file.Transforms, ","))
+	}
+	if file.LineNumbers {
+		attrs += " line_numbers=\"true\""
+	}
+	start := fmt.Sprintf("<document%s>\n<source>%s</source>\n<document_content>", attrs, escapeXMLText(file.RelPath))
+	if _, err := io.WriteString(r.w, start); err != nil {
+		return fmt.Errorf("failed to write start separator for %s: %w", file.RelPath, err)
+	}
+	cdata := &cdataWriter{w: r.w}
+	if err := file.WriteContent(cdata); err != nil {
+		return err
+	}
+	if err := cdata.Close(); err != nil {
+		return fmt.Errorf("failed to write content for %s: %w", file.RelPath, err)
+	}
+	if _, err := io.WriteString(r.w, "</document_content>\n</document>\n"); err != nil {
+		return fmt.Errorf("failed to write end separator for %s: %w", file.RelPath, err)
+	}
+	return nil
+}
+
+func (r *xmlRenderer) SkipFile(file FileInfo, reason string) error {
+	r.skipped = append(r.skipped, SkippedRecord{Path: file.RelPath, Reason: reason})
+	return nil
+}
+
+func (r *xmlRenderer) EndDocument() error {
+	if r.index > 0 {
+		if _, err := io.WriteString(r.w, "</documents>\n"); err != nil {
+			return fmt.Errorf("failed to write documents end tag: %w", err)
+		}
+	}
+	if len(r.skipped) == 0 {
+		return nil
+	}
+	var b strings.Builder
+	b.WriteString("\n<skipped_files>\n")
+	for _, s := range r.skipped {
+		fmt.Fprintf(&b, "<file reason=\"%s\">%s</file>\n", escapeXMLAttr(s.Reason), escapeXMLText(s.Path))
+	}
+	b.WriteString("</skipped_files>\n")
+	if _, err := io.WriteString(r.w, b.String()); err != nil {
+		return fmt.Errorf("failed to write skipped files: %w", err)
+	}
+	return nil
+}
+
+// xmlTextEscaper escapes XML markup characters but, unlike xml.EscapeText,
+// leaves newlines and tabs alone so the tree stays readable.
+var xmlTextEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// escapeXMLText escapes s for use as XML character data.
+func escapeXMLText(s string) string {
+	return xmlTextEscaper.Replace(s)
+}
+
+// escapeXMLAttr escapes s for use inside a double-quoted attribute value.
+func escapeXMLAttr(s string) string {
+	return strings.ReplaceAll(escapeXMLText(s), "\"", "&quot;")
+}